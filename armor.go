@@ -0,0 +1,148 @@
+package blobcrypt
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+)
+
+const (
+	armorHeader    = "-----BEGIN BLOBCRYPT-----"
+	armorFooter    = "-----END BLOBCRYPT-----"
+	armorLineWidth = 64
+)
+
+// ErrArmor indicates armored input is missing its header or footer lines.
+var ErrArmor = errors.New("Input is not a valid armored blob")
+
+// ArmorWriter encodes everything written to it as base64 lines between BEGIN and END BLOBCRYPT lines,
+// in the style of PEM, so small blobs can be pasted into email, chat, or config files.
+// Close must be called to write the final line and footer; It does not close the underlying writer.
+type ArmorWriter struct {
+	w       io.Writer
+	encoder io.WriteCloser
+	lines   *lineWrapper
+	started bool
+}
+
+// NewArmorWriter returns an ArmorWriter that writes armored output to w.
+func NewArmorWriter(w io.Writer) *ArmorWriter {
+	lines := &lineWrapper{w: w}
+	return &ArmorWriter{
+		w:       w,
+		encoder: base64.NewEncoder(base64.StdEncoding, lines),
+		lines:   lines,
+	}
+}
+
+func (a *ArmorWriter) start() error {
+	if a.started {
+		return nil
+	}
+	a.started = true
+	_, err := io.WriteString(a.w, armorHeader+"\n")
+	return err
+}
+
+// Write encodes p to the underlying writer.
+func (a *ArmorWriter) Write(p []byte) (int, error) {
+	if err := a.start(); err != nil {
+		return 0, err
+	}
+	return a.encoder.Write(p)
+}
+
+// Close flushes any partial base64 line, and writes the footer.
+func (a *ArmorWriter) Close() error {
+	if err := a.start(); err != nil {
+		return err
+	}
+	if err := a.encoder.Close(); err != nil {
+		return err
+	}
+	if a.lines.column > 0 {
+		if _, err := io.WriteString(a.w, "\n"); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(a.w, armorFooter+"\n")
+	return err
+}
+
+// lineWrapper inserts a newline after every armorLineWidth bytes written.
+type lineWrapper struct {
+	w      io.Writer
+	column int
+}
+
+func (l *lineWrapper) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := armorLineWidth - l.column
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := l.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		l.column += n
+		p = p[n:]
+
+		if l.column == armorLineWidth {
+			if _, err := io.WriteString(l.w, "\n"); err != nil {
+				return written, err
+			}
+			l.column = 0
+		}
+	}
+	return written, nil
+}
+
+// NewArmorReader returns a reader that decodes armored input produced by ArmorWriter.
+// Blank lines and surrounding whitespace are ignored, and text before the header is skipped,
+// so armored blobs may be pasted with surrounding context.
+// Reading returns ErrArmor if the header or footer is missing.
+func NewArmorReader(r io.Reader) io.Reader {
+	return base64.NewDecoder(base64.StdEncoding, &armorBodyReader{lines: bufio.NewReader(r)})
+}
+
+// armorBodyReader returns the base64 text between armor header and footer, without newlines.
+type armorBodyReader struct {
+	lines   *bufio.Reader
+	started bool
+	done    bool
+	pending []byte
+}
+
+func (a *armorBodyReader) Read(p []byte) (int, error) {
+	for len(a.pending) == 0 {
+		if a.done {
+			return 0, io.EOF
+		}
+
+		line, err := a.lines.ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+			if errors.Is(err, io.EOF) {
+				return 0, ErrArmor
+			}
+			return 0, err
+		}
+		line = strings.TrimSpace(line)
+
+		switch {
+		case !a.started:
+			a.started = line == armorHeader
+		case line == armorFooter:
+			a.done = true
+		default:
+			a.pending = []byte(line)
+		}
+	}
+
+	n := copy(p, a.pending)
+	a.pending = a.pending[n:]
+	return n, nil
+}
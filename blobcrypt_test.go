@@ -2,9 +2,21 @@ package blobcrypt
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
 	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -106,3 +118,947 @@ func TestHMAC(t *testing.T) {
 		t.Fatal("Returned hash differs from embedded hash")
 	}
 }
+
+// TestBytesRoundTrip ensures the in-memory helpers round-trip small payloads and enforce their limits.
+func TestBytesRoundTrip(t *testing.T) {
+	payload := []byte("A small manifest or token")
+
+	ciphertext, key, err := EncryptBytes(payload, "secret", 2048)
+	if err != nil {
+		t.Fatalf("%v encrypting bytes", err)
+	}
+
+	decrypted, err := DecryptBytes(ciphertext, key, 2048)
+	if err != nil {
+		t.Fatalf("%v decrypting bytes", err)
+	}
+	if !bytes.Equal(decrypted, payload) {
+		t.Fatalf("Output did not match")
+	}
+
+	if _, _, err := EncryptBytes(payload, "", 4); err != ErrSizeLimit {
+		t.Fatalf("Expected ErrSizeLimit encrypting, got %v", err)
+	}
+	if _, err := DecryptBytes(ciphertext, key, 4); err != ErrSizeLimit {
+		t.Fatalf("Expected ErrSizeLimit decrypting, got %v", err)
+	}
+}
+
+// TestKeychainPersistence ensures keys saved by a JSON-backed Keychain are restored by a new one.
+func TestKeychainPersistence(t *testing.T) {
+	store := JSONKeyStore{Path: filepath.Join(t.TempDir(), "keychain.json")}
+
+	keychain, err := NewKeychain(store)
+	if err != nil {
+		t.Fatalf("%v creating Keychain", err)
+	}
+
+	mac := []byte{0x01, 0x02, 0x03}
+	key := []byte{0x04, 0x05, 0x06}
+	keychain.Add(mac, key)
+	if err := keychain.Save(); err != nil {
+		t.Fatalf("%v saving Keychain", err)
+	}
+
+	reloaded, err := NewKeychain(store)
+	if err != nil {
+		t.Fatalf("%v reloading Keychain", err)
+	}
+	if found, ok := reloaded.Lookup(mac); !ok || !bytes.Equal(found, key) {
+		t.Fatalf("Key was not restored")
+	}
+}
+
+// TestKeychainZeroValue ensures a Keychain that wasn't made by NewKeychain is usable,
+// and that keys returned by Lookup can't modify the Keychain.
+func TestKeychainZeroValue(t *testing.T) {
+	var keychain Keychain
+
+	mac := []byte{0x01, 0x02, 0x03}
+	keychain.Add(mac, []byte{0x04, 0x05, 0x06})
+	found, ok := keychain.Lookup(mac)
+	if !ok {
+		t.Fatal("Key was not found")
+	}
+	found[0] = 0xff
+	if again, _ := keychain.Lookup(mac); again[0] != 0x04 {
+		t.Fatal("Modifying a looked-up key changed the Keychain")
+	}
+	if err := keychain.Save(); err != nil {
+		t.Fatalf("%v saving memory-only Keychain", err)
+	}
+}
+
+// TestChunkKeyVectors checks ChunkKey against fixed test vectors, so the derivation never changes silently.
+func TestChunkKeyVectors(t *testing.T) {
+	sequential := make([]byte, 32)
+	for i := range sequential {
+		sequential[i] = byte(i)
+	}
+
+	vectors := []struct {
+		fileKey  []byte
+		index    uint64
+		expected string
+	}{
+		{make([]byte, 32), 0, "03e4f9dd6b1a04a5d4fef956db729567cd33616242b78b6fcbce382232ce5e10"},
+		{make([]byte, 32), 1, "c27b4c62278b1a60484ec761d1eed75ca0e460264ea39ecea7f79940411ee1e1"},
+		{sequential, 42, "e1f0e5d70f9aec48e58ae6367a401fc042cbf6b8254f5bbc621c091cea579b64"},
+	}
+
+	for _, v := range vectors {
+		if result := hex.EncodeToString(ChunkKey(v.fileKey, v.index)); result != v.expected {
+			t.Errorf("ChunkKey(%x, %d) = %s, expected %s", v.fileKey, v.index, result, v.expected)
+		}
+	}
+}
+
+// TestComputeHMAC ensures the HMAC recomputed from detached ciphertext matches the one returned by Encrypt.
+func TestComputeHMAC(t *testing.T) {
+	ciphertext, key, err := EncryptBytes([]byte("Detached trailer"), "", 1024)
+	if err != nil {
+		t.Fatalf("%v encrypting bytes", err)
+	}
+
+	body := ciphertext[:len(ciphertext)-MACSize]
+	mac, err := ComputeHMAC(bytes.NewReader(body), key)
+	if err != nil {
+		t.Fatalf("%v computing HMAC", err)
+	}
+	if !hmac.Equal(mac, ciphertext[len(body):]) {
+		t.Fatal("Computed HMAC differs from embedded HMAC")
+	}
+}
+
+// TestComputeKeyFromDigest ensures a key derived from a precomputed digest matches ComputeKey.
+func TestComputeKeyFromDigest(t *testing.T) {
+	content := []byte("Content hashed elsewhere")
+	digest := sha256.Sum256(content)
+
+	key, err := ComputeKeyFromDigest(digest[:], "")
+	if err != nil {
+		t.Fatalf("%v computing key from digest", err)
+	}
+	expected, err := ComputeKey(bytes.NewReader(content), "")
+	if err != nil {
+		t.Fatalf("%v computing key", err)
+	}
+	if !bytes.Equal(key, expected) {
+		t.Fatal("Key from digest differs from computed key")
+	}
+
+	if _, err := ComputeKeyFromDigest(digest[:], "secret"); err == nil {
+		t.Fatal("Expected an error using a convergence secret")
+	}
+}
+
+// TestEncryptTee ensures the tee receives exactly the encrypted body, and that NewMAC over it matches.
+func TestEncryptTee(t *testing.T) {
+	input := bytes.NewReader([]byte("Interleaved processing"))
+	key, err := ComputeKey(input, "")
+	if err != nil {
+		t.Fatalf("%v computing key", err)
+	}
+	writer, err := NewWriter(input, key)
+	if err != nil {
+		t.Fatalf("%v creating Writer", err)
+	}
+
+	var output bytes.Buffer
+	mac := NewMAC(key)
+	result, err := writer.EncryptTee(&output, mac)
+	if err != nil {
+		t.Fatalf("%v encrypting input", err)
+	}
+	if !hmac.Equal(mac.Sum(nil), result) {
+		t.Fatal("HMAC of tee differs from returned HMAC")
+	}
+}
+
+// TestSynchronousRoundTrip ensures synchronous Writers and Readers produce the same results as streaming ones.
+func TestSynchronousRoundTrip(t *testing.T) {
+	randomBytes := make([]byte, 100000)
+	if _, err := rand.Read(randomBytes); err != nil {
+		t.Fatalf("%v reading random bytes", err)
+	}
+	input := bytes.NewReader(randomBytes)
+
+	key, err := ComputeKey(input, "")
+	if err != nil {
+		t.Fatalf("%v computing key", err)
+	}
+
+	writer, err := NewWriter(input, key)
+	if err != nil {
+		t.Fatalf("%v creating Writer", err)
+	}
+	writer.Synchronous = true
+
+	var output bytes.Buffer
+	if _, err := writer.Encrypt(&output); err != nil {
+		t.Fatalf("%v encrypting input", err)
+	}
+
+	expected, _, err := EncryptBytes(randomBytes, "", len(randomBytes))
+	if err != nil {
+		t.Fatalf("%v encrypting bytes", err)
+	}
+	if !bytes.Equal(output.Bytes(), expected) {
+		t.Fatal("Synchronous output differs from streaming output")
+	}
+
+	reader, err := NewReader(bytes.NewReader(output.Bytes()), key)
+	if err != nil {
+		t.Fatalf("%v creating Reader", err)
+	}
+	reader.Synchronous = true
+
+	var decrypted bytes.Buffer
+	if err := reader.Decrypt(&decrypted); err != nil {
+		t.Fatalf("%v decrypting output", err)
+	}
+	if !bytes.Equal(decrypted.Bytes(), randomBytes) {
+		t.Fatal("Output did not match")
+	}
+}
+
+// TestSuiteRegistry ensures custom suites can be registered and used, and that IDs cannot be reused.
+func TestSuiteRegistry(t *testing.T) {
+	// The registry is global, so only register the test suite once when tests are repeated.
+	const testSuite SuiteID = 250
+	if _, err := LookupSuite(testSuite); err != nil {
+		err := RegisterSuite(Suite{
+			ID:        testSuite,
+			Name:      "AES256-CTR-HMAC-SHA256",
+			NewStream: newAESCTRStream,
+			NewMAC: func(key []byte) hash.Hash {
+				return hmac.New(sha256.New, key)
+			},
+		})
+		if err != nil {
+			t.Fatalf("%v registering suite", err)
+		}
+	}
+	if err := RegisterSuite(Suite{ID: DefaultSuite, NewStream: newAESCTRStream, NewMAC: NewMAC}); err == nil {
+		t.Fatal("Expected an error registering a duplicate suite")
+	}
+
+	plaintext := []byte("Encrypted with a custom suite")
+	input := bytes.NewReader(plaintext)
+	key, err := ComputeKey(input, "")
+	if err != nil {
+		t.Fatalf("%v computing key", err)
+	}
+	writer, err := NewWriter(input, key)
+	if err != nil {
+		t.Fatalf("%v creating Writer", err)
+	}
+	writer.Suite = testSuite
+
+	var output bytes.Buffer
+	mac, err := writer.Encrypt(&output)
+	if err != nil {
+		t.Fatalf("%v encrypting input", err)
+	}
+	if len(mac) != sha256.Size {
+		t.Fatalf("Expected a %d byte HMAC, got %d", sha256.Size, len(mac))
+	}
+
+	if _, err := NewReader(bytes.NewReader(output.Bytes()), key); err == nil {
+		t.Fatal("Expected default suite to reject custom suite output")
+	}
+	reader, err := NewReader(bytes.NewReader(output.Bytes()), key, WithCipher(testSuite))
+	if err != nil {
+		t.Fatalf("%v creating Reader", err)
+	}
+
+	var decrypted bytes.Buffer
+	if err := reader.Decrypt(&decrypted); err != nil {
+		t.Fatalf("%v decrypting output", err)
+	}
+	if !bytes.Equal(decrypted.Bytes(), plaintext) {
+		t.Fatal("Output did not match")
+	}
+}
+
+// TestCheckKeyStrict ensures malformed layouts are rejected with specific errors.
+func TestCheckKeyStrict(t *testing.T) {
+	ciphertext, key, err := EncryptBytes([]byte("Uploaded blob"), "", 1024)
+	if err != nil {
+		t.Fatalf("%v encrypting bytes", err)
+	}
+	empty, emptyKey, err := EncryptBytes(nil, "", 1024)
+	if err != nil {
+		t.Fatalf("%v encrypting empty bytes", err)
+	}
+
+	cases := []struct {
+		name     string
+		source   []byte
+		key      []byte
+		expected error
+	}{
+		{"valid", ciphertext, key, nil},
+		{"too short", ciphertext[:MACSize-1], key, ErrTooShort},
+		{"empty body", empty, emptyKey, ErrEmptyBody},
+		{"trailing garbage", append(append([]byte(nil), ciphertext...), 0x00), key, ErrHMACMismatch},
+	}
+
+	for _, c := range cases {
+		if _, err := CheckKeyStrict(bytes.NewReader(c.source), c.key); err != c.expected {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, err)
+		}
+	}
+
+	// Non-strict checks accept empty bodies
+	if _, err := CheckKey(bytes.NewReader(empty), emptyKey); err != nil {
+		t.Errorf("%v checking empty body", err)
+	}
+}
+
+// TestOptions ensures progress is reported and a canceled context stops encryption.
+func TestOptions(t *testing.T) {
+	randomBytes := make([]byte, 1<<16)
+	if _, err := rand.Read(randomBytes); err != nil {
+		t.Fatalf("%v reading random bytes", err)
+	}
+	input := bytes.NewReader(randomBytes)
+
+	key, err := ComputeKey(input, "")
+	if err != nil {
+		t.Fatalf("%v computing key", err)
+	}
+
+	var progress int64
+	writer, err := NewWriter(input, key, WithBufferSize(1024), WithProgress(func(total int64) {
+		progress = total
+	}))
+	if err != nil {
+		t.Fatalf("%v creating Writer", err)
+	}
+	if _, err := writer.Encrypt(ioutil.Discard); err != nil {
+		t.Fatalf("%v encrypting input", err)
+	}
+	if progress != int64(len(randomBytes)) {
+		t.Fatalf("Expected progress of %d, got %d", len(randomBytes), progress)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, synchronous := range []bool{false, true} {
+		if _, err := input.Seek(0, io.SeekStart); err != nil {
+			t.Fatalf("%v seeking input", err)
+		}
+		opts := []Option{WithContext(ctx)}
+		if synchronous {
+			opts = append(opts, WithSynchronous())
+		}
+		writer, err := NewWriter(input, key, opts...)
+		if err != nil {
+			t.Fatalf("%v creating Writer", err)
+		}
+		if _, err := writer.Encrypt(ioutil.Discard); err != context.Canceled {
+			t.Fatalf("Expected context.Canceled (synchronous: %v), got %v", synchronous, err)
+		}
+	}
+}
+
+// TestCheckKeyDetailed ensures failures report the stage at which they occurred.
+func TestCheckKeyDetailed(t *testing.T) {
+	ciphertext, key, err := EncryptBytes([]byte("Diagnosed blob"), "", 1024)
+	if err != nil {
+		t.Fatalf("%v encrypting bytes", err)
+	}
+
+	result, err := CheckKeyDetailed(bytes.NewReader(ciphertext), key)
+	if err != nil {
+		t.Fatalf("%v checking valid blob", err)
+	}
+	if result.BodySize != int64(len(ciphertext)-MACSize) || result.BytesExamined != result.BodySize {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+
+	corrupt := append([]byte(nil), ciphertext...)
+	corrupt[0] ^= 0xFF
+
+	cases := []struct {
+		name     string
+		source   []byte
+		stage    CheckStage
+		expected error
+	}{
+		{"too short", ciphertext[:10], CheckStageSize, ErrTooShort},
+		{"corrupt", corrupt, CheckStageHMAC, ErrHMACMismatch},
+	}
+
+	for _, c := range cases {
+		_, err := CheckKeyDetailed(bytes.NewReader(c.source), key)
+		var checkErr *CheckError
+		if !errors.As(err, &checkErr) {
+			t.Errorf("%s: expected a CheckError, got %v", c.name, err)
+			continue
+		}
+		if checkErr.Stage != c.stage || !errors.Is(err, c.expected) {
+			t.Errorf("%s: expected %v at %v stage, got %v", c.name, c.expected, c.stage, err)
+		}
+	}
+}
+
+// TestFileRoundTrip ensures EncryptFile and DecryptFile round-trip a file on disk without leaving temporary files.
+func TestFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	plainPath := filepath.Join(dir, "plain.txt")
+	encPath := filepath.Join(dir, "plain.txt.enc")
+	decPath := filepath.Join(dir, "decrypted.txt")
+
+	content := []byte("A file on disk")
+	if err := ioutil.WriteFile(plainPath, content, 0600); err != nil {
+		t.Fatalf("%v writing input", err)
+	}
+
+	key, _, err := EncryptFile(plainPath, encPath, "secret")
+	if err != nil {
+		t.Fatalf("%v encrypting file", err)
+	}
+	if err := DecryptFile(encPath, decPath, key); err != nil {
+		t.Fatalf("%v decrypting file", err)
+	}
+
+	decrypted, err := ioutil.ReadFile(decPath)
+	if err != nil {
+		t.Fatalf("%v reading output", err)
+	}
+	if !bytes.Equal(decrypted, content) {
+		t.Fatal("Output did not match")
+	}
+
+	// A failed decryption must not create its output
+	failedPath := filepath.Join(dir, "failed.txt")
+	if err := DecryptFile(plainPath, failedPath, key); err == nil {
+		t.Fatal("Expected an error decrypting unencrypted input")
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("%v listing directory", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 files, found %d", len(entries))
+	}
+}
+
+// TestKeySerialization ensures keys round-trip through text encodings, and are redacted when formatted.
+func TestKeySerialization(t *testing.T) {
+	key, err := ComputeKey(bytes.NewReader([]byte("Key material")), "")
+	if err != nil {
+		t.Fatalf("%v computing key", err)
+	}
+
+	text, err := key.MarshalText()
+	if err != nil {
+		t.Fatalf("%v marshaling key", err)
+	}
+	for _, encoded := range []string{string(text), base64.StdEncoding.EncodeToString(key)} {
+		parsed, err := ParseKey(encoded)
+		if err != nil {
+			t.Fatalf("%v parsing %s", err, encoded)
+		}
+		if !parsed.Equal(key) {
+			t.Fatalf("Parsed key %s does not match", encoded)
+		}
+	}
+
+	if _, err := ParseKey("abcd"); err == nil {
+		t.Fatal("Expected an error parsing a short key")
+	}
+
+	// Every verb prints the placeholder itself, never hex that could be saved as a key.
+	for _, verb := range []string{"%v", "%s", "%x", "%X", "%q", "%d", "%#v", "%+v", "%64x"} {
+		if formatted := fmt.Sprintf(verb, key); formatted != "Key(REDACTED)" {
+			t.Fatalf("Key formatted with %s as %q, expected the redacted placeholder", verb, formatted)
+		}
+	}
+	if formatted := fmt.Sprintf("%x", []Key{key}); strings.Contains(formatted, key.Hex()) || formatted != "[Key(REDACTED)]" {
+		t.Fatalf("Key in a slice formatted with %%x as %q", formatted)
+	}
+}
+
+// TestArmorRoundTrip ensures armored output is line-wrapped text that decrypts correctly, even with surrounding context.
+func TestArmorRoundTrip(t *testing.T) {
+	plaintext := []byte("A token to paste into a config file")
+	input := bytes.NewReader(plaintext)
+	key, err := ComputeKey(input, "")
+	if err != nil {
+		t.Fatalf("%v computing key", err)
+	}
+
+	writer, err := NewWriter(input, key, WithArmor())
+	if err != nil {
+		t.Fatalf("%v creating Writer", err)
+	}
+	var output bytes.Buffer
+	if _, err := writer.Encrypt(&output); err != nil {
+		t.Fatalf("%v encrypting input", err)
+	}
+
+	armored := output.String()
+	if !strings.HasPrefix(armored, armorHeader+"\n") || !strings.HasSuffix(armored, armorFooter+"\n") {
+		t.Fatalf("Armored output is missing header or footer:\n%s", armored)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(armored), "\n") {
+		if len(line) > armorLineWidth {
+			t.Fatalf("Armored line exceeds %d characters: %s", armorLineWidth, line)
+		}
+	}
+
+	pasted := "Here is the token:\n\n" + armored + "\nThanks!\n"
+	reader, err := NewReader(strings.NewReader(pasted), key, WithArmor())
+	if err != nil {
+		t.Fatalf("%v creating Reader", err)
+	}
+	var decrypted bytes.Buffer
+	if err := reader.Decrypt(&decrypted); err != nil {
+		t.Fatalf("%v decrypting output", err)
+	}
+	if !bytes.Equal(decrypted.Bytes(), plaintext) {
+		t.Fatal("Output did not match")
+	}
+
+	truncated := armored[:len(armored)-len(armorFooter)-1]
+	if _, err := NewReader(strings.NewReader(truncated), key, WithArmor()); err != ErrArmor {
+		t.Fatalf("Expected ErrArmor for a missing footer, got %v", err)
+	}
+}
+
+// TestTruncatedMACSuite ensures truncated blobs round-trip, and are rejected by readers expecting the default suite.
+func TestTruncatedMACSuite(t *testing.T) {
+	plaintext := []byte("Tiny record")
+	input := bytes.NewReader(plaintext)
+	key, err := ComputeKey(input, "")
+	if err != nil {
+		t.Fatalf("%v computing key", err)
+	}
+
+	writer, err := NewWriter(input, key, WithCipher(TruncatedMACSuite))
+	if err != nil {
+		t.Fatalf("%v creating Writer", err)
+	}
+	var output bytes.Buffer
+	mac, err := writer.Encrypt(&output)
+	if err != nil {
+		t.Fatalf("%v encrypting input", err)
+	}
+	if output.Len() != len(plaintext)+32 || len(mac) != 32 {
+		t.Fatalf("Expected a 32 byte trailer, got %d bytes of output", output.Len())
+	}
+
+	full, _, err := EncryptBytes(plaintext, "", 1024)
+	if err != nil {
+		t.Fatalf("%v encrypting bytes", err)
+	}
+	if !bytes.Equal(mac, full[len(plaintext):len(plaintext)+32]) {
+		t.Fatal("Truncated HMAC is not a prefix of the full HMAC")
+	}
+
+	if _, err := NewReader(bytes.NewReader(output.Bytes()), key); err != ErrTooShort && err != ErrHMACMismatch {
+		t.Fatalf("Expected default suite to reject truncated blob, got %v", err)
+	}
+	if offset, err := CheckKey(bytes.NewReader(output.Bytes()), key, WithCipher(TruncatedMACSuite)); err != nil || offset != int64(len(plaintext)) {
+		t.Fatalf("CheckKey with TruncatedMACSuite returned %d, %v", offset, err)
+	}
+	reader, err := NewReader(bytes.NewReader(output.Bytes()), key, WithCipher(TruncatedMACSuite))
+	if err != nil {
+		t.Fatalf("%v creating Reader", err)
+	}
+	var decrypted bytes.Buffer
+	if err := reader.Decrypt(&decrypted); err != nil {
+		t.Fatalf("%v decrypting output", err)
+	}
+	if !bytes.Equal(decrypted.Bytes(), plaintext) {
+		t.Fatal("Output did not match")
+	}
+}
+
+// TestComputeKeyHash ensures alternative hashes are used for key derivation, and must produce full-size keys.
+func TestComputeKeyHash(t *testing.T) {
+	content := []byte("Hashed with an alternative function")
+
+	key, err := ComputeKeyHash(bytes.NewReader(content), "", sha512.New512_256)
+	if err != nil {
+		t.Fatalf("%v computing key", err)
+	}
+	expected := sha512.Sum512_256(content)
+	if !bytes.Equal(key, expected[:]) {
+		t.Fatal("Key does not match the provided hash")
+	}
+
+	if _, err := ComputeKeyHash(bytes.NewReader(content), "", sha512.New); err == nil {
+		t.Fatal("Expected an error for a hash of the wrong size")
+	}
+}
+
+// TestComputeTreeKey ensures tree keys follow the documented layout, regardless of worker count.
+func TestComputeTreeKey(t *testing.T) {
+	randomBytes := make([]byte, 3*TreeLeafSize+12345)
+	if _, err := rand.Read(randomBytes); err != nil {
+		t.Fatalf("%v reading random bytes", err)
+	}
+	cs := "secret"
+
+	// Compute the expected key directly from the documented layout
+	root := sha256.New()
+	root.Write([]byte{0x01, 0, 0, 0, 0, 0, 0, 0, byte(len(cs))})
+	root.Write([]byte(cs))
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(len(randomBytes)))
+	root.Write(size[:])
+	for offset := 0; offset < len(randomBytes); offset += TreeLeafSize {
+		end := offset + TreeLeafSize
+		if end > len(randomBytes) {
+			end = len(randomBytes)
+		}
+		leaf := sha256.Sum256(append([]byte{0x00}, randomBytes[offset:end]...))
+		root.Write(leaf[:])
+	}
+	expected := root.Sum(nil)
+
+	for _, workers := range []int{1, 3, 0} {
+		key, err := ComputeTreeKey(bytes.NewReader(randomBytes), int64(len(randomBytes)), cs, workers)
+		if err != nil {
+			t.Fatalf("%v computing tree key", err)
+		}
+		if !bytes.Equal(key, expected) {
+			t.Fatalf("Tree key with %d workers does not match layout", workers)
+		}
+	}
+}
+
+// TestComputeTreeKeyShortSource ensures a source shorter than the claimed size is an error,
+// rather than a key hashed over stale buffer contents.
+func TestComputeTreeKeyShortSource(t *testing.T) {
+	randomBytes := make([]byte, TreeLeafSize+100)
+	if _, err := rand.Read(randomBytes); err != nil {
+		t.Fatalf("%v reading random bytes", err)
+	}
+
+	_, err := ComputeTreeKey(bytes.NewReader(randomBytes), int64(len(randomBytes))+50, "", 1)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("Expected io.ErrUnexpectedEOF for a short source, got %v", err)
+	}
+	if _, err := ComputeTreeKey(bytes.NewReader(randomBytes), -1, "", 1); err == nil {
+		t.Fatal("Expected an error for a negative size")
+	}
+}
+
+// TestInspect ensures the reported layout matches the size of the blob and the MAC size of its suite.
+func TestInspect(t *testing.T) {
+	ciphertext, _, err := EncryptBytes([]byte("Located without a key"), "", 1024)
+	if err != nil {
+		t.Fatalf("%v encrypting bytes", err)
+	}
+	layout, err := Inspect(bytes.NewReader(ciphertext))
+	if err != nil {
+		t.Fatalf("%v inspecting blob", err)
+	}
+	if layout.Size != int64(len(ciphertext)) || layout.MACSize != MACSize || layout.MACOffset+int64(layout.MACSize) != layout.Size {
+		t.Fatalf("Unexpected layout %+v", layout)
+	}
+
+	truncated, err := InspectSize(100, WithCipher(TruncatedMACSuite))
+	if err != nil {
+		t.Fatalf("%v inspecting size", err)
+	}
+	if truncated.BodySize != 68 || truncated.MACSize != 32 {
+		t.Fatalf("Unexpected truncated layout %+v", truncated)
+	}
+
+	if _, err := InspectSize(10); err != ErrTooShort {
+		t.Fatalf("Expected ErrTooShort, got %v", err)
+	}
+}
+
+// TestWriterHMAC ensures the HMAC computed without output matches the one returned by Encrypt.
+func TestWriterHMAC(t *testing.T) {
+	plaintext := []byte("Identity without ciphertext")
+	ciphertext, key, err := EncryptBytes(plaintext, "", 1024)
+	if err != nil {
+		t.Fatalf("%v encrypting bytes", err)
+	}
+
+	writer, err := NewWriter(bytes.NewReader(plaintext), key)
+	if err != nil {
+		t.Fatalf("%v creating Writer", err)
+	}
+	mac, err := writer.HMAC()
+	if err != nil {
+		t.Fatalf("%v computing HMAC", err)
+	}
+	if !hmac.Equal(mac, ciphertext[len(plaintext):]) {
+		t.Fatal("HMAC differs from embedded HMAC")
+	}
+}
+
+// TestWriteTo ensures Writer and Reader round-trip through WriteTo, and report the bytes written.
+func TestWriteTo(t *testing.T) {
+	// Larger than one buffer, so pooled buffers are reused within a single stream.
+	plaintext := make([]byte, cipherStreamBufferSize*3+7)
+	if _, err := rand.Read(plaintext); err != nil {
+		t.Fatalf("%v reading random bytes", err)
+	}
+	key, err := ComputeKey(bytes.NewReader(plaintext), "")
+	if err != nil {
+		t.Fatalf("%v computing key", err)
+	}
+
+	for _, synchronous := range []bool{false, true} {
+		opts := []Option{}
+		if synchronous {
+			opts = append(opts, WithSynchronous())
+		}
+
+		writer, err := NewWriter(bytes.NewReader(plaintext), key, opts...)
+		if err != nil {
+			t.Fatalf("%v creating Writer", err)
+		}
+		var ciphertext bytes.Buffer
+		n, err := writer.WriteTo(&ciphertext)
+		if err != nil {
+			t.Fatalf("%v encrypting with WriteTo", err)
+		}
+		if n != int64(len(plaintext)+MACSize) || n != int64(ciphertext.Len()) {
+			t.Fatalf("Writer reported %d bytes, wrote %d", n, ciphertext.Len())
+		}
+
+		reader, err := NewReader(bytes.NewReader(ciphertext.Bytes()), key, opts...)
+		if err != nil {
+			t.Fatalf("%v creating Reader", err)
+		}
+		var decrypted bytes.Buffer
+		n, err = reader.WriteTo(&decrypted)
+		if err != nil {
+			t.Fatalf("%v decrypting with WriteTo", err)
+		}
+		if n != int64(len(plaintext)) || !bytes.Equal(decrypted.Bytes(), plaintext) {
+			t.Fatal("Decrypted content does not match plaintext")
+		}
+	}
+}
+
+func benchmarkSmallFiles(b *testing.B, synchronous bool) {
+	plaintext := make([]byte, 4096)
+	if _, err := rand.Read(plaintext); err != nil {
+		b.Fatalf("%v reading random bytes", err)
+	}
+	key, err := ComputeKey(bytes.NewReader(plaintext), "")
+	if err != nil {
+		b.Fatalf("%v computing key", err)
+	}
+	source := bytes.NewReader(plaintext)
+	opts := []Option{}
+	if synchronous {
+		opts = append(opts, WithSynchronous())
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(plaintext)))
+	for i := 0; i < b.N; i++ {
+		source.Seek(0, io.SeekStart)
+		writer, err := NewWriter(source, key, opts...)
+		if err != nil {
+			b.Fatalf("%v creating Writer", err)
+		}
+		if _, err := writer.WriteTo(ioutil.Discard); err != nil {
+			b.Fatalf("%v encrypting", err)
+		}
+	}
+}
+
+// BenchmarkEncryptSmallFile measures per-file overhead, including allocations, for small sources.
+func BenchmarkEncryptSmallFile(b *testing.B) {
+	benchmarkSmallFiles(b, false)
+}
+
+// BenchmarkEncryptSmallFileSynchronous is BenchmarkEncryptSmallFile with WithSynchronous.
+func BenchmarkEncryptSmallFileSynchronous(b *testing.B) {
+	benchmarkSmallFiles(b, true)
+}
+
+// TestEncryptAppend ensures appending to a blob produces the same bytes as encrypting the grown source with the original key.
+func TestEncryptAppend(t *testing.T) {
+	// An odd length ensures the append starts mid-block.
+	original := make([]byte, 100003)
+	appended := make([]byte, 54321)
+	for _, b := range [][]byte{original, appended} {
+		if _, err := rand.Read(b); err != nil {
+			t.Fatalf("%v reading random bytes", err)
+		}
+	}
+
+	key, err := ComputeKey(bytes.NewReader(original), "")
+	if err != nil {
+		t.Fatalf("%v computing key", err)
+	}
+
+	writer, err := NewWriter(bytes.NewReader(original), key)
+	if err != nil {
+		t.Fatalf("%v creating Writer", err)
+	}
+	var blob bytes.Buffer
+	_, checkpoint, err := writer.EncryptCheckpoint(&blob)
+	if err != nil {
+		t.Fatalf("%v encrypting original", err)
+	}
+
+	// Round-trip the checkpoint through its serialized form, as a later process would.
+	data, err := checkpoint.MarshalBinary()
+	if err != nil {
+		t.Fatalf("%v marshaling checkpoint", err)
+	}
+	var restored Checkpoint
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatalf("%v unmarshaling checkpoint", err)
+	}
+
+	recovered, err := CheckpointFromCiphertext(bytes.NewReader(blob.Bytes()[:len(original)]), key)
+	if err != nil {
+		t.Fatalf("%v recovering checkpoint", err)
+	}
+	if recoveredData, _ := recovered.MarshalBinary(); !bytes.Equal(recoveredData, data) {
+		t.Fatal("Checkpoint recovered from ciphertext differs")
+	}
+
+	appender, err := NewWriter(bytes.NewReader(appended), key)
+	if err != nil {
+		t.Fatalf("%v creating Writer", err)
+	}
+	blob.Truncate(int(restored.Offset))
+	if _, _, err := appender.EncryptAppend(&blob, restored); err != nil {
+		t.Fatalf("%v appending", err)
+	}
+
+	grown := append(append([]byte(nil), original...), appended...)
+	expected, err := NewWriter(bytes.NewReader(grown), key)
+	if err != nil {
+		t.Fatalf("%v creating Writer", err)
+	}
+	var expectedBlob bytes.Buffer
+	if _, err := expected.Encrypt(&expectedBlob); err != nil {
+		t.Fatalf("%v encrypting grown source", err)
+	}
+	if !bytes.Equal(blob.Bytes(), expectedBlob.Bytes()) {
+		t.Fatal("Appended blob differs from full encryption")
+	}
+}
+
+// failingWriter accepts limit bytes, then fails, simulating an interrupted upload.
+type failingWriter struct {
+	bytes.Buffer
+	limit int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if f.Len()+len(p) > f.limit {
+		return 0, io.ErrShortWrite
+	}
+	return f.Buffer.Write(p)
+}
+
+// TestEncryptResume ensures an interrupted encryption resumed from a checkpoint produces the same blob.
+func TestEncryptResume(t *testing.T) {
+	randomBytes := make([]byte, 200000)
+	if _, err := rand.Read(randomBytes); err != nil {
+		t.Fatalf("%v reading random bytes", err)
+	}
+	input := bytes.NewReader(randomBytes)
+	key, err := ComputeKey(input, "")
+	if err != nil {
+		t.Fatalf("%v computing key", err)
+	}
+
+	var saved []byte
+	writer, err := NewWriter(input, key, WithBufferSize(4096), WithCheckpoints(50000, func(c Checkpoint) {
+		saved, _ = c.MarshalBinary()
+	}))
+	if err != nil {
+		t.Fatalf("%v creating Writer", err)
+	}
+	interrupted := &failingWriter{limit: 120000}
+	if _, err := writer.Encrypt(interrupted); err != io.ErrShortWrite {
+		t.Fatalf("Expected interrupted encryption, got %v", err)
+	}
+
+	var checkpoint Checkpoint
+	if err := checkpoint.UnmarshalBinary(saved); err != nil {
+		t.Fatalf("%v unmarshaling checkpoint", err)
+	}
+	if checkpoint.Offset < 100000 || checkpoint.Offset > int64(interrupted.Len()) {
+		t.Fatalf("Unexpected checkpoint offset %d", checkpoint.Offset)
+	}
+
+	// A checkpoint can't be continued with another key, such as one recomputed after the source changed.
+	otherKey := make([]byte, KeySize)
+	wrongKey, err := NewWriter(bytes.NewReader(randomBytes), otherKey)
+	if err != nil {
+		t.Fatalf("%v creating Writer", err)
+	}
+	if _, err := wrongKey.EncryptResume(ioutil.Discard, checkpoint); err != ErrCheckpointKey {
+		t.Fatalf("Expected ErrCheckpointKey resuming with another key, got %v", err)
+	}
+	if _, _, err := wrongKey.EncryptAppend(ioutil.Discard, checkpoint); err != ErrCheckpointKey {
+		t.Fatalf("Expected ErrCheckpointKey appending with another key, got %v", err)
+	}
+
+	// A new process resumes from the checkpoint, keeping only the output it covers.
+	resumer, err := NewWriter(bytes.NewReader(randomBytes), key)
+	if err != nil {
+		t.Fatalf("%v creating Writer", err)
+	}
+	blob := bytes.NewBuffer(interrupted.Bytes()[:checkpoint.Offset])
+	if _, err := resumer.EncryptResume(blob, checkpoint); err != nil {
+		t.Fatalf("%v resuming encryption", err)
+	}
+
+	expected, _, err := EncryptBytes(randomBytes, "", len(randomBytes))
+	if err != nil {
+		t.Fatalf("%v encrypting bytes", err)
+	}
+	if !bytes.Equal(blob.Bytes(), expected) {
+		t.Fatal("Resumed blob differs from uninterrupted encryption")
+	}
+
+	// A checkpoint whose offset disagrees with its MAC state is rejected.
+	corrupt := append([]byte(nil), saved...)
+	corrupt[8]++
+	if err := checkpoint.UnmarshalBinary(corrupt); err == nil {
+		t.Fatal("Expected an error unmarshaling a corrupt checkpoint")
+	}
+	corrupt[1] = 0x80
+	if err := checkpoint.UnmarshalBinary(corrupt); err == nil {
+		t.Fatal("Expected an error unmarshaling a negative offset")
+	}
+}
+
+// TestCheckpointArmor ensures checkpoints are refused for armored output, whose length doesn't match their offsets.
+func TestCheckpointArmor(t *testing.T) {
+	plaintext := []byte("Armored and interrupted")
+	key, err := ComputeKey(bytes.NewReader(plaintext), "")
+	if err != nil {
+		t.Fatalf("%v computing key", err)
+	}
+
+	writer, err := NewWriter(bytes.NewReader(plaintext), key, WithArmor(), WithCheckpoints(8, func(Checkpoint) {}))
+	if err != nil {
+		t.Fatalf("%v creating Writer", err)
+	}
+	if _, err := writer.Encrypt(ioutil.Discard); err != ErrCheckpointArmor {
+		t.Fatalf("Expected ErrCheckpointArmor, got %v", err)
+	}
+
+	writer, err = NewWriter(bytes.NewReader(plaintext), key, WithArmor())
+	if err != nil {
+		t.Fatalf("%v creating Writer", err)
+	}
+	if _, _, err := writer.EncryptCheckpoint(ioutil.Discard); err != ErrCheckpointArmor {
+		t.Fatalf("Expected ErrCheckpointArmor from EncryptCheckpoint, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+// Package blobtar reads and writes tar archives whose members are individually encrypted with blobcrypt.
+//
+// Each member's content is a complete blobcrypt blob: the encrypted file followed by its HMAC suffix.
+// The key needed to decrypt a member is stored in the member's PAX header records, either
+// wrapped with a bundle key using AES-256-GCM, or in the clear when no bundle key is used.
+// Member names, sizes and times are not encrypted.
+package blobtar
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	blobcrypt "github.com/home-orbit/go-blob-encryption"
+)
+
+// Writer writes blobcrypt-encrypted members to a tar archive.
+type Writer struct {
+	tw      *tar.Writer
+	wrapKey []byte
+}
+
+// NewWriter returns a Writer that writes a tar archive to w.
+// If wrapKey is non-nil, it must be a 32 byte key used to wrap each member's key;
+// Otherwise member keys are stored unwrapped, and anyone with the archive can decrypt it.
+func NewWriter(w io.Writer, wrapKey []byte) *Writer {
+	return &Writer{tw: tar.NewWriter(w), wrapKey: wrapKey}
+}
+
+// Add encrypts source as a member called name, using a key computed with convergence secret cs.
+// Returns the HMAC of the encrypted member.
+func (w *Writer) Add(name string, source io.ReadSeeker, cs string, modTime time.Time) ([]byte, error) {
+	size, err := source.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := source.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	key, err := blobcrypt.ComputeKey(source, cs)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := EncodeKeyRecords(name, key, w.wrapKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header := &tar.Header{
+		Typeflag:   tar.TypeReg,
+		Name:       name,
+		Mode:       0600,
+		Size:       size + blobcrypt.MACSize,
+		ModTime:    modTime,
+		Format:     tar.FormatPAX,
+		PAXRecords: records,
+	}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return nil, err
+	}
+
+	writer, err := blobcrypt.NewWriter(source, key)
+	if err != nil {
+		return nil, err
+	}
+	return writer.Encrypt(w.tw)
+}
+
+// Close writes the tar footer. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	return w.tw.Close()
+}
+
+// Reader reads blobcrypt-encrypted members from a tar archive.
+type Reader struct {
+	tr      *tar.Reader
+	wrapKey []byte
+}
+
+// NewReader returns a Reader that reads a tar archive from r.
+// wrapKey must be the bundle key used by the Writer, or nil if keys were stored unwrapped.
+func NewReader(r io.Reader, wrapKey []byte) *Reader {
+	return &Reader{tr: tar.NewReader(r), wrapKey: wrapKey}
+}
+
+// Member is an encrypted member of an archive.
+type Member struct {
+	Header *tar.Header
+	Key    blobcrypt.Key
+
+	content io.Reader
+}
+
+// Next advances to the next encrypted member, skipping entries that are not regular files.
+// Returns io.EOF at the end of the archive.
+func (r *Reader) Next() (*Member, error) {
+	for {
+		header, err := r.tr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		key, err := DecodeKeyRecords(header.Name, header.PAXRecords, r.wrapKey)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", header.Name, err)
+		}
+		return &Member{Header: header, Key: key, content: r.tr}, nil
+	}
+}
+
+// Decrypt verifies and decrypts the member's content to w. It must be called before the next call to Next.
+// Tar content is not seekable, so the encrypted member is first spooled to a temporary file,
+// ensuring nothing is written to w unless the member is intact.
+func (m *Member) Decrypt(w io.Writer) error {
+	spool, err := ioutil.TempFile("", "blobtar-spool-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	if _, err := io.Copy(spool, m.content); err != nil {
+		return err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader, err := blobcrypt.NewReader(spool, m.Key)
+	if err != nil {
+		return err
+	}
+	return reader.Decrypt(w)
+}
@@ -0,0 +1,81 @@
+package blobtar
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+	"time"
+)
+
+// TestRoundTrip ensures members written with and without a bundle key decrypt to their original content.
+func TestRoundTrip(t *testing.T) {
+	bundleKey := make([]byte, 32)
+	if _, err := rand.Read(bundleKey); err != nil {
+		t.Fatalf("%v reading random bytes", err)
+	}
+
+	members := map[string][]byte{
+		"first.txt":      []byte("The first member"),
+		"dir/second.bin": bytes.Repeat([]byte{0xAB}, 100000),
+	}
+
+	for _, wrapKey := range [][]byte{nil, bundleKey} {
+		var archive bytes.Buffer
+		writer := NewWriter(&archive, wrapKey)
+		for _, name := range []string{"first.txt", "dir/second.bin"} {
+			if _, err := writer.Add(name, bytes.NewReader(members[name]), "", time.Now()); err != nil {
+				t.Fatalf("%v adding %s", err, name)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("%v closing archive", err)
+		}
+
+		reader := NewReader(bytes.NewReader(archive.Bytes()), wrapKey)
+		count := 0
+		for {
+			member, err := reader.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%v reading member", err)
+			}
+
+			var decrypted bytes.Buffer
+			if err := member.Decrypt(&decrypted); err != nil {
+				t.Fatalf("%v decrypting %s", err, member.Header.Name)
+			}
+			if !bytes.Equal(decrypted.Bytes(), members[member.Header.Name]) {
+				t.Fatalf("%s did not match", member.Header.Name)
+			}
+			count++
+		}
+		if count != len(members) {
+			t.Fatalf("Expected %d members, read %d", len(members), count)
+		}
+	}
+}
+
+// TestWrongBundleKey ensures wrapped member keys cannot be recovered without the bundle key.
+func TestWrongBundleKey(t *testing.T) {
+	bundleKey := make([]byte, 32)
+	if _, err := rand.Read(bundleKey); err != nil {
+		t.Fatalf("%v reading random bytes", err)
+	}
+
+	var archive bytes.Buffer
+	writer := NewWriter(&archive, bundleKey)
+	if _, err := writer.Add("secret.txt", bytes.NewReader([]byte("Secret")), "", time.Now()); err != nil {
+		t.Fatalf("%v adding member", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("%v closing archive", err)
+	}
+
+	for _, wrapKey := range [][]byte{nil, make([]byte, 32)} {
+		if _, err := NewReader(bytes.NewReader(archive.Bytes()), wrapKey).Next(); err == nil {
+			t.Fatal("Expected an error reading a member without its bundle key")
+		}
+	}
+}
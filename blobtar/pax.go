@@ -0,0 +1,112 @@
+package blobtar
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	blobcrypt "github.com/home-orbit/go-blob-encryption"
+)
+
+// PAX record names used to store a member's key in its tar header.
+const (
+	// PAXKeyRecord holds the member's key, encoded according to its type.
+	PAXKeyRecord = "BLOBCRYPT.key"
+	// PAXKeyTypeRecord holds the KeyType describing how PAXKeyRecord is encoded.
+	PAXKeyTypeRecord = "BLOBCRYPT.key.type"
+)
+
+// KeyType describes how a member's key is stored in PAXKeyRecord.
+type KeyType string
+
+const (
+	// KeyTypeRaw stores the key unwrapped, as hex.
+	KeyTypeRaw KeyType = "raw"
+	// KeyTypeAES256GCM stores the key wrapped with a bundle key, as base64(nonce || sealed key).
+	KeyTypeAES256GCM KeyType = "aes256-gcm"
+)
+
+// SupportedKeyTypes returns the key types that DecodeKeyRecords can read.
+func SupportedKeyTypes() []KeyType {
+	return []KeyType{KeyTypeRaw, KeyTypeAES256GCM}
+}
+
+// EncodeKeyRecords returns the PAX records that store key for the member called name.
+// If wrapKey is nil, the key is stored as hex with type KeyTypeRaw. Otherwise it is wrapped with
+// the 32 byte wrapKey using AES-256-GCM, with the member name as additional authenticated data,
+// and stored as base64(nonce || sealed key) with type KeyTypeAES256GCM.
+func EncodeKeyRecords(name string, key, wrapKey []byte) (map[string]string, error) {
+	if wrapKey == nil {
+		return map[string]string{PAXKeyTypeRecord: string(KeyTypeRaw), PAXKeyRecord: hex.EncodeToString(key)}, nil
+	}
+
+	aead, err := newAEAD(wrapKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	// The member name is authenticated, so a wrapped key cannot be moved to another member.
+	wrapped := aead.Seal(nonce, nonce, key, []byte(name))
+	return map[string]string{PAXKeyTypeRecord: string(KeyTypeAES256GCM), PAXKeyRecord: base64.StdEncoding.EncodeToString(wrapped)}, nil
+}
+
+// DecodeKeyRecords returns the key stored by EncodeKeyRecords in the PAX records of the member called name.
+// wrapKey is required for wrapped keys. If wrapKey is given, raw keys are rejected, so that a member
+// with an unwrapped key can't be added to or substituted into an archive protected by a bundle key.
+func DecodeKeyRecords(name string, records map[string]string, wrapKey []byte) (blobcrypt.Key, error) {
+	encoded, ok := records[PAXKeyRecord]
+	if !ok {
+		return nil, fmt.Errorf("Member has no %s record", PAXKeyRecord)
+	}
+
+	switch keyType := KeyType(records[PAXKeyTypeRecord]); keyType {
+	case KeyTypeRaw:
+		if wrapKey != nil {
+			return nil, fmt.Errorf("Member key is not wrapped, but a bundle key was provided")
+		}
+		return blobcrypt.ParseKey(encoded)
+
+	case KeyTypeAES256GCM:
+		if wrapKey == nil {
+			return nil, fmt.Errorf("Member key is wrapped, but no bundle key was provided")
+		}
+		aead, err := newAEAD(wrapKey)
+		if err != nil {
+			return nil, err
+		}
+		wrapped, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+		if len(wrapped) < aead.NonceSize() {
+			return nil, fmt.Errorf("Wrapped key is too short")
+		}
+		nonce, sealed := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+		key, err := aead.Open(nil, nonce, sealed, []byte(name))
+		if err != nil {
+			return nil, fmt.Errorf("Member key could not be unwrapped; The bundle key may be wrong")
+		}
+		return blobcrypt.Key(key), blobcrypt.Key(key).Validate()
+
+	default:
+		return nil, fmt.Errorf("Key type %q is not supported", keyType)
+	}
+}
+
+func newAEAD(wrapKey []byte) (cipher.AEAD, error) {
+	if len(wrapKey) != blobcrypt.KeySize {
+		return nil, fmt.Errorf("Bundle key size is incorrect")
+	}
+	block, err := aes.NewCipher(wrapKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,75 @@
+package blobtar
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestKeyRecords ensures keys round-trip through PAX records of every supported type.
+func TestKeyRecords(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	bundleKey := bytes.Repeat([]byte{0x24}, 32)
+
+	for _, wrapKey := range [][]byte{nil, bundleKey} {
+		records, err := EncodeKeyRecords("member.txt", key, wrapKey)
+		if err != nil {
+			t.Fatalf("%v encoding records", err)
+		}
+
+		expectedType := KeyTypeRaw
+		if wrapKey != nil {
+			expectedType = KeyTypeAES256GCM
+		}
+		if KeyType(records[PAXKeyTypeRecord]) != expectedType {
+			t.Fatalf("Expected key type %s, got %s", expectedType, records[PAXKeyTypeRecord])
+		}
+
+		decoded, err := DecodeKeyRecords("member.txt", records, wrapKey)
+		if err != nil {
+			t.Fatalf("%v decoding %s records", err, expectedType)
+		}
+		if !decoded.Equal(key) {
+			t.Fatalf("Decoded %s key does not match", expectedType)
+		}
+	}
+
+	// Raw records are a fixed, documented encoding.
+	raw := map[string]string{
+		PAXKeyTypeRecord: "raw",
+		PAXKeyRecord:     "4242424242424242424242424242424242424242424242424242424242424242",
+	}
+	if decoded, err := DecodeKeyRecords("any", raw, nil); err != nil || !decoded.Equal(key) {
+		t.Fatalf("Failed to decode literal raw records: %v", err)
+	}
+}
+
+// TestKeyRecordErrors ensures wrapped keys are bound to their member, and raw or unknown types are rejected.
+func TestKeyRecordErrors(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	bundleKey := bytes.Repeat([]byte{0x24}, 32)
+
+	records, err := EncodeKeyRecords("member.txt", key, bundleKey)
+	if err != nil {
+		t.Fatalf("%v encoding records", err)
+	}
+	if _, err := DecodeKeyRecords("renamed.txt", records, bundleKey); err == nil {
+		t.Fatal("Expected an error decoding a wrapped key under another member name")
+	}
+
+	// An archive protected by a bundle key can't carry members with unwrapped keys.
+	raw, err := EncodeKeyRecords("member.txt", key, nil)
+	if err != nil {
+		t.Fatalf("%v encoding raw records", err)
+	}
+	if _, err := DecodeKeyRecords("member.txt", raw, bundleKey); err == nil {
+		t.Fatal("Expected an error decoding a raw key when a bundle key is provided")
+	}
+
+	unknown := map[string]string{PAXKeyTypeRecord: "rot13", PAXKeyRecord: "abc"}
+	if _, err := DecodeKeyRecords("member.txt", unknown, nil); err == nil {
+		t.Fatal("Expected an error decoding an unsupported key type")
+	}
+	if _, err := DecodeKeyRecords("member.txt", map[string]string{}, nil); err == nil {
+		t.Fatal("Expected an error decoding a member without key records")
+	}
+}
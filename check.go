@@ -0,0 +1,129 @@
+package blobcrypt
+
+import (
+	"crypto/hmac"
+	"fmt"
+	"io"
+)
+
+// CheckStage identifies the step of validation at which CheckKeyDetailed failed.
+type CheckStage int
+
+const (
+	// CheckStageSize indicates the source size could not be determined, or is invalid for the layout.
+	CheckStageSize CheckStage = iota
+	// CheckStageTrailer indicates the HMAC suffix could not be read.
+	CheckStageTrailer
+	// CheckStageBody indicates the encrypted content could not be read.
+	CheckStageBody
+	// CheckStageHMAC indicates the calculated HMAC did not match the embedded HMAC.
+	CheckStageHMAC
+)
+
+func (s CheckStage) String() string {
+	switch s {
+	case CheckStageSize:
+		return "size"
+	case CheckStageTrailer:
+		return "trailer"
+	case CheckStageBody:
+		return "body"
+	case CheckStageHMAC:
+		return "HMAC"
+	}
+	return fmt.Sprintf("CheckStage(%d)", int(s))
+}
+
+// CheckResult describes a source examined by CheckKeyDetailed.
+type CheckResult struct {
+	// Size is the total size of the source, including the HMAC suffix.
+	Size int64
+	// BodySize is the size of the encrypted content, and the offset at which the HMAC suffix begins.
+	BodySize int64
+	// BytesExamined is the number of encrypted content bytes read before returning.
+	BytesExamined int64
+	// EmbeddedHMAC is the HMAC suffix read from the source, if it could be read.
+	EmbeddedHMAC []byte
+	// HMAC is the HMAC calculated over the encrypted content, if it could be read in full.
+	HMAC []byte
+}
+
+// CheckError reports the stage at which CheckKeyDetailed failed, and the underlying error.
+type CheckError struct {
+	Stage         CheckStage
+	BytesExamined int64
+	Err           error
+}
+
+func (e *CheckError) Error() string {
+	return fmt.Sprintf("Check failed at %v stage after %d bytes: %v", e.Stage, e.BytesExamined, e.Err)
+}
+
+func (e *CheckError) Unwrap() error {
+	return e.Err
+}
+
+// CheckKeyDetailed behaves like CheckKey, configured by opts (only WithCipher and WithStrict apply),
+// but reports everything learned about source in a CheckResult.
+// On failure, the result is partially filled, and the error is a *CheckError identifying the failed stage.
+func CheckKeyDetailed(source io.ReadSeeker, key []byte, opts ...Option) (CheckResult, error) {
+	o := newOptions(opts)
+	var result CheckResult
+
+	suite, err := LookupSuite(o.suite)
+	if err != nil {
+		return result, err
+	}
+	mac := suite.NewMAC(key)
+	macSize := int64(mac.Size())
+
+	fail := func(stage CheckStage, err error) (CheckResult, error) {
+		return result, &CheckError{Stage: stage, BytesExamined: result.BytesExamined, Err: err}
+	}
+
+	// Ensure the source is large enough to contain the trailer before seeking to it.
+	if result.Size, err = source.Seek(0, io.SeekEnd); err != nil {
+		return fail(CheckStageSize, err)
+	}
+	if result.Size < macSize {
+		return fail(CheckStageSize, ErrTooShort)
+	}
+	if o.strict && result.Size == macSize {
+		return fail(CheckStageSize, ErrEmptyBody)
+	}
+	result.BodySize = result.Size - macSize
+
+	// Skip to the trailer, and read the embedded HMAC value
+	if _, err := source.Seek(result.BodySize, io.SeekStart); err != nil {
+		return fail(CheckStageTrailer, err)
+	}
+	embeddedHMAC := make([]byte, macSize)
+	if _, err := io.ReadFull(source, embeddedHMAC); err != nil {
+		return fail(CheckStageTrailer, err)
+	}
+	result.EmbeddedHMAC = embeddedHMAC
+
+	// Return to the beginning of the file and scan up to the trailer
+	if _, err := source.Seek(0, io.SeekStart); err != nil {
+		return fail(CheckStageBody, err)
+	}
+	result.BytesExamined, err = io.Copy(mac, io.LimitReader(source, result.BodySize))
+	if err != nil {
+		return fail(CheckStageBody, err)
+	}
+	if result.BytesExamined != result.BodySize {
+		return fail(CheckStageBody, io.ErrUnexpectedEOF)
+	}
+	result.HMAC = mac.Sum(nil)
+
+	// Require the embedded HMAC to match the one we just calculated.
+	if !hmac.Equal(result.HMAC, result.EmbeddedHMAC) {
+		return fail(CheckStageHMAC, ErrHMACMismatch)
+	}
+
+	// Reset source position before returning
+	if _, err := source.Seek(0, io.SeekStart); err != nil {
+		return fail(CheckStageBody, err)
+	}
+	return result, nil
+}
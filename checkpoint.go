@@ -0,0 +1,280 @@
+package blobcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// checkpointVersion is the first byte of a serialized Checkpoint, allowing the encoding to change.
+const checkpointVersion = 2
+
+// checkpointHeaderSize is the length of a serialized Checkpoint before its MAC state:
+// the version, the big-endian Offset, and the key fingerprint.
+const checkpointHeaderSize = 1 + 8 + keyFingerprintSize
+
+// keyFingerprintSize is the length of the key fingerprint stored in a Checkpoint.
+const keyFingerprintSize = 16
+
+// ErrCheckpointUnsupported is returned when a checkpoint is requested for a suite other than DefaultSuite.
+var ErrCheckpointUnsupported = errors.New("Checkpoints are only supported by DefaultSuite")
+
+// ErrCheckpointArmor is returned when checkpoints are requested for a Writer with armored output,
+// whose length does not correspond to a checkpoint's Offset.
+var ErrCheckpointArmor = errors.New("Checkpoints cannot be used with armored output")
+
+// ErrCheckpointKey is returned when a checkpoint is used with a key other than the one that produced it.
+var ErrCheckpointKey = errors.New("Checkpoint was taken with a different key")
+
+// sha512StateMagic and sha512StateSize describe the state serialized by crypto/sha512's digest,
+// whose final 8 bytes are the big-endian count of bytes written.
+const (
+	sha512StateMagic = "sha\x07"
+	sha512StateSize  = len(sha512StateMagic) + 8*8 + sha512.BlockSize + 8
+)
+
+// Checkpoint is the state of an encryption after Offset bytes of content: the position of the
+// cipher stream, and the state of the HMAC over the ciphertext so far.
+// A Checkpoint allows encryption to continue later, even in another process, without
+// reprocessing the first Offset bytes. It contains key-derived secrets, and must be stored as
+// carefully as the key. A Checkpoint records a fingerprint of its key, and can only be continued
+// with that key.
+type Checkpoint struct {
+	// Offset is the number of content bytes encrypted before the checkpoint was taken.
+	Offset int64
+
+	// fingerprint identifies the key the checkpoint was taken with, without revealing it.
+	fingerprint []byte
+	macState    []byte
+}
+
+// MarshalBinary encodes the checkpoint as an opaque, versioned byte string.
+func (c Checkpoint) MarshalBinary() ([]byte, error) {
+	data := make([]byte, checkpointHeaderSize, checkpointHeaderSize+len(c.macState))
+	data[0] = checkpointVersion
+	binary.BigEndian.PutUint64(data[1:9], uint64(c.Offset))
+	copy(data[9:checkpointHeaderSize], c.fingerprint)
+	return append(data, c.macState...), nil
+}
+
+// UnmarshalBinary decodes a checkpoint encoded by MarshalBinary.
+func (c *Checkpoint) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return fmt.Errorf("Checkpoint is too short")
+	}
+	if data[0] != checkpointVersion {
+		return fmt.Errorf("Checkpoint version %d is not supported", data[0])
+	}
+	if len(data) < checkpointHeaderSize {
+		return fmt.Errorf("Checkpoint is too short")
+	}
+	offset := int64(binary.BigEndian.Uint64(data[1:9]))
+	state := data[checkpointHeaderSize:]
+	if offset < 0 {
+		return fmt.Errorf("Checkpoint offset %d is negative", offset)
+	}
+
+	// The MAC has absorbed its padded key block and exactly Offset bytes of ciphertext;
+	// Any other count means the checkpoint is corrupt, and would continue with the wrong keystream.
+	if len(state) != sha512StateSize || string(state[:len(sha512StateMagic)]) != sha512StateMagic {
+		return fmt.Errorf("Checkpoint MAC state is invalid")
+	}
+	if written := binary.BigEndian.Uint64(state[len(state)-8:]); written != uint64(offset)+sha512.BlockSize {
+		return fmt.Errorf("Checkpoint offset %d does not match its MAC state", offset)
+	}
+
+	c.Offset = offset
+	c.fingerprint = append([]byte(nil), data[9:checkpointHeaderSize]...)
+	c.macState = append([]byte(nil), state...)
+	return nil
+}
+
+// CheckpointFromCiphertext returns the checkpoint at the end of body, the encrypted content of
+// a blob without its HMAC suffix. This recovers a checkpoint for a blob whose state was not saved,
+// at the cost of reading its content once; No decryption is required.
+func CheckpointFromCiphertext(body io.Reader, key []byte) (Checkpoint, error) {
+	mac, err := newResumableMAC(key, nil)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	offset, err := io.Copy(mac, body)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	return mac.checkpoint(offset)
+}
+
+// EncryptCheckpoint behaves like Encrypt, and also returns the checkpoint at the end of the content,
+// from which EncryptAppend can later continue. Only DefaultSuite is supported.
+func (w *Writer) EncryptCheckpoint(output io.Writer) ([]byte, Checkpoint, error) {
+	if w.armor {
+		return nil, Checkpoint{}, ErrCheckpointArmor
+	}
+	return w.encryptFrom(output, nil, Checkpoint{})
+}
+
+// EncryptAppend encrypts content appended to a blob's source, continuing from the checkpoint
+// at the end of the blob's existing content. Source must contain only the appended plaintext,
+// and Key must be the key the blob was originally encrypted with, or ErrCheckpointKey is returned.
+//
+// Output receives the ciphertext for the appended content followed by a new HMAC suffix.
+// To update the blob, truncate it to from.Offset bytes, removing the old suffix, and append output.
+// Returns the new HMAC, and a checkpoint from which to continue after the next append.
+//
+// The updated blob is decryptable with the original key, but is no longer convergent:
+// it differs from a blob produced by encrypting the grown source with its own key.
+func (w *Writer) EncryptAppend(output io.Writer, from Checkpoint) ([]byte, Checkpoint, error) {
+	if from.macState == nil {
+		return nil, Checkpoint{}, fmt.Errorf("Checkpoint is empty")
+	}
+	if w.armor {
+		return nil, Checkpoint{}, ErrCheckpointArmor
+	}
+	return w.encryptFrom(output, nil, from)
+}
+
+// EncryptResume continues an interrupted encryption from a checkpoint reported by WithCheckpoints,
+// using the same Key; Checkpoints taken with another key are rejected with ErrCheckpointKey.
+// Source is repositioned to from.Offset, and output receives the remaining ciphertext and the
+// HMAC suffix; Appending output to the first from.Offset bytes of the interrupted output yields
+// the same blob that an uninterrupted Encrypt would have produced.
+func (w *Writer) EncryptResume(output io.Writer, from Checkpoint) ([]byte, error) {
+	if from.macState == nil {
+		return nil, fmt.Errorf("Checkpoint is empty")
+	}
+	if w.armor {
+		return nil, ErrCheckpointArmor
+	}
+	if _, err := w.Source.Seek(from.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	mac, _, err := w.encryptFrom(output, nil, from)
+	return mac, err
+}
+
+// encryptFrom encrypts Source with DefaultSuite, continuing from a checkpoint.
+func (w *Writer) encryptFrom(output, tee io.Writer, from Checkpoint) ([]byte, Checkpoint, error) {
+	if w.Suite != DefaultSuite {
+		return nil, Checkpoint{}, ErrCheckpointUnsupported
+	}
+
+	if from.macState != nil && subtle.ConstantTimeCompare(from.fingerprint, keyFingerprint(w.Key)) != 1 {
+		return nil, Checkpoint{}, ErrCheckpointKey
+	}
+
+	stream, err := newAESCTRStreamAt(w.Key, from.Offset)
+	if err != nil {
+		return nil, Checkpoint{}, err
+	}
+	mac, err := newResumableMAC(w.Key, from.macState)
+	if err != nil {
+		return nil, Checkpoint{}, err
+	}
+
+	written, hmacFinal, err := w.encryptStream(output, tee, stream, mac, from.Offset)
+	if err != nil {
+		return nil, Checkpoint{}, err
+	}
+
+	checkpoint, err := mac.checkpoint(from.Offset + written)
+	return hmacFinal, checkpoint, err
+}
+
+// newAESCTRStreamAt returns the stream used by DefaultSuite, advanced to offset bytes into the content.
+func newAESCTRStreamAt(key []byte, offset int64) (cipher.Stream, error) {
+	blockCipher, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// CTR treats the IV as a big-endian counter, incremented once per block.
+	iv := shaSlice256(key)[:aes.BlockSize]
+	blocks := uint64(offset / aes.BlockSize)
+	for i := aes.BlockSize - 1; i >= 0 && blocks > 0; i-- {
+		sum := uint64(iv[i]) + blocks&0xff
+		iv[i] = byte(sum)
+		blocks = blocks>>8 + sum>>8
+	}
+	stream := cipher.NewCTR(blockCipher, iv)
+
+	// Discard the keystream for any partial block before offset.
+	if partial := offset % aes.BlockSize; partial > 0 {
+		skip := make([]byte, partial)
+		stream.XORKeyStream(skip, skip)
+	}
+	return stream, nil
+}
+
+// resumableMAC is the HMAC-SHA512 used by DefaultSuite, implemented over a plain SHA512 digest
+// so that its inner state can be serialized and restored.
+type resumableMAC struct {
+	inner       hash.Hash
+	fingerprint []byte
+	ipad        [sha512.BlockSize]byte
+	opad        [sha512.BlockSize]byte
+}
+
+// newResumableMAC returns the MAC for key, restoring its inner state from state if non-nil.
+func newResumableMAC(key []byte, state []byte) (*resumableMAC, error) {
+	// The derived HMAC key is shorter than the block size, so it is zero-padded rather than hashed.
+	hmacKey := shaSlice256(shaSlice256(key))
+
+	m := &resumableMAC{inner: sha512.New(), fingerprint: keyFingerprint(key)}
+	copy(m.ipad[:], hmacKey)
+	copy(m.opad[:], hmacKey)
+	for i := range m.ipad {
+		m.ipad[i] ^= 0x36
+		m.opad[i] ^= 0x5c
+	}
+
+	if state == nil {
+		m.inner.Write(m.ipad[:])
+		return m, nil
+	}
+	if err := m.inner.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *resumableMAC) checkpoint(offset int64) (Checkpoint, error) {
+	state, err := m.inner.(encoding.BinaryMarshaler).MarshalBinary()
+	return Checkpoint{Offset: offset, fingerprint: m.fingerprint, macState: state}, err
+}
+
+// keyFingerprint identifies key in a Checkpoint. It is derived from the HMAC key,
+// which is itself a one-way function of key, and truncated to keyFingerprintSize bytes.
+func keyFingerprint(key []byte) []byte {
+	return shaSlice256(shaSlice256(shaSlice256(key)))[:keyFingerprintSize]
+}
+
+func (m *resumableMAC) Write(p []byte) (int, error) {
+	return m.inner.Write(p)
+}
+
+func (m *resumableMAC) Sum(b []byte) []byte {
+	outer := sha512.New()
+	outer.Write(m.opad[:])
+	outer.Write(m.inner.Sum(nil))
+	return outer.Sum(b)
+}
+
+func (m *resumableMAC) Reset() {
+	m.inner.Reset()
+	m.inner.Write(m.ipad[:])
+}
+
+func (m *resumableMAC) Size() int {
+	return sha512.Size
+}
+
+func (m *resumableMAC) BlockSize() int {
+	return sha512.BlockSize
+}
@@ -0,0 +1,41 @@
+package blobcrypt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// chunkKeyInfo prefixes the HKDF info parameter for chunk keys, separating them from other derivations.
+const chunkKeyInfo = "blobcrypt chunk key v1"
+
+// ChunkKey derives the key for the chunk at index within a file whose key is fileKey.
+//
+// The derivation is HKDF-SHA256 (RFC 5869) with fileKey as the input keying material,
+// an empty salt, and an info parameter of "blobcrypt chunk key v1" followed by index
+// as a big-endian uint64. The result is always sha256.Size bytes, suitable for NewWriter.
+func ChunkKey(fileKey []byte, index uint64) []byte {
+	info := make([]byte, len(chunkKeyInfo)+8)
+	copy(info, chunkKeyInfo)
+	binary.BigEndian.PutUint64(info[len(chunkKeyInfo):], index)
+
+	return hkdfSHA256(fileKey, nil, info)
+}
+
+// hkdfSHA256 returns a single block (sha256.Size bytes) of HKDF-SHA256 output.
+func hkdfSHA256(secret, salt, info []byte) []byte {
+	if salt == nil {
+		salt = make([]byte, sha256.Size)
+	}
+
+	// Extract
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+
+	// Expand; One block of output only requires T(1) = HMAC(PRK, info || 0x01)
+	expand := hmac.New(sha256.New, prk)
+	expand.Write(info)
+	expand.Write([]byte{0x01})
+	return expand.Sum(nil)
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/cipher"
 	"errors"
 	"io"
+	"sync"
 )
 
 const (
@@ -12,11 +13,109 @@ const (
 	cipherStreamBufferSize  = 16384
 )
 
+// bufferPool holds default-sized buffers for reuse by CipherStream, so that enciphering many
+// small files doesn't allocate new buffers for each one.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, cipherStreamBufferSize)
+		return &buf
+	},
+}
+
 // CipherStream may be run in a goroutine to stream enciphered blocks to its Channel.
 type CipherStream struct {
 	Source io.Reader
 	Cipher cipher.Stream
 	Error  error
+
+	// Synchronous causes Each to encipher blocks in the caller's goroutine, using a single buffer.
+	Synchronous bool
+	// BufferSize is the size of each enciphered block. If zero, a default of 16KB is used.
+	BufferSize int
+}
+
+// Each enciphers the contents of Source, calling fn with each enciphered block in order.
+// Unless Synchronous is set, reading and enciphering happen in parallel with fn via Stream.
+// The block passed to fn is only valid until fn returns.
+// Returns the first error returned by fn, encountered reading Source, or from ctx.
+func (cs *CipherStream) Each(ctx context.Context, fn func([]byte) error) error {
+	if cs.Synchronous {
+		return cs.run(ctx, fn)
+	}
+
+	// Buffers are borrowed from bufferPool, and are only returned once the stream goroutine has exited.
+	var bufs [cipherStreamBufferCount][]byte
+	for i := range bufs {
+		bufs[i] = cs.getBuffer()
+	}
+
+	// Configure a cancelable context, ensuring goroutines won't be leaked on early return.
+	streamCtx, cancel := context.WithCancel(ctx)
+	channel := cs.stream(streamCtx, bufs)
+	defer func() {
+		// On early return the goroutine may still be filling a buffer; Drain until it closes the channel.
+		cancel()
+		for range channel {
+		}
+		for _, buf := range bufs {
+			cs.putBuffer(buf)
+		}
+	}()
+
+	for buf := range channel {
+		if err := fn(buf); err != nil {
+			return err
+		}
+	}
+
+	// The stream closes without error when canceled, so check the caller's context explicitly.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// If the stream exited abnormally due to a read error, return it.
+	return cs.Error
+}
+
+// WriteTo enciphers the contents of Source to w, implementing io.WriterTo.
+// Returns the number of bytes written to w.
+func (cs *CipherStream) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	err := cs.Each(context.Background(), func(buf []byte) error {
+		written, err := w.Write(buf)
+		n += int64(written)
+		return err
+	})
+	return n, err
+}
+
+// run enciphers the contents of Source in the caller's goroutine, calling fn with each block.
+func (cs *CipherStream) run(ctx context.Context, fn func([]byte) error) error {
+	buf := cs.getBuffer()
+	defer cs.putBuffer(buf)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		l, err := cs.Source.Read(buf)
+
+		if l > 0 {
+			filled := buf[:l]
+			cs.Cipher.XORKeyStream(filled, filled)
+			if err := fn(filled); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			cs.Error = err
+			return err
+		}
+	}
 }
 
 // Stream starts a goroutine that sends blocks of enciphered content to a channel,
@@ -24,6 +123,16 @@ type CipherStream struct {
 // Returns a channel on which enciphered blocks will be streamed to the receiver.
 // If an error occurs, the channel is closed and CipherStream's Error will be non-nil.
 func (cs *CipherStream) Stream(ctx context.Context) chan []byte {
+	// The receiver may hold the last block indefinitely, so these buffers are never pooled.
+	var bufs [cipherStreamBufferCount][]byte
+	for i := range bufs {
+		bufs[i] = make([]byte, cs.bufferSize())
+	}
+	return cs.stream(ctx, bufs)
+}
+
+// stream implements Stream, enciphering into bufs in turn.
+func (cs *CipherStream) stream(ctx context.Context, bufs [cipherStreamBufferCount][]byte) chan []byte {
 	// Channel capacity is reduced by 2 to allow for an active input and output buffer.
 	channel := make(chan []byte, cipherStreamBufferCount-2)
 
@@ -31,11 +140,6 @@ func (cs *CipherStream) Stream(ctx context.Context) chan []byte {
 		defer close(channel)
 		// Writes to channel block when full, so we can use round-robin buffers.
 		// One buffer must be reserved for input and one for output at all times.
-		var bufs [cipherStreamBufferCount][]byte
-		for i := range bufs {
-			bufs[i] = make([]byte, cipherStreamBufferSize)
-		}
-
 		canceled := ctx.Done()
 		source := cs.Source
 		cipher := cs.Cipher
@@ -76,3 +180,26 @@ func (cs *CipherStream) Stream(ctx context.Context) chan []byte {
 
 	return channel
 }
+
+func (cs *CipherStream) bufferSize() int {
+	if cs.BufferSize > 0 {
+		return cs.BufferSize
+	}
+	return cipherStreamBufferSize
+}
+
+// getBuffer returns a buffer of bufferSize bytes, from bufferPool if it is the default size.
+func (cs *CipherStream) getBuffer() []byte {
+	if cs.bufferSize() != cipherStreamBufferSize {
+		return make([]byte, cs.bufferSize())
+	}
+	return *bufferPool.Get().(*[]byte)
+}
+
+// putBuffer returns buf to bufferPool if it is the default size. Other sizes are left to the GC.
+func (cs *CipherStream) putBuffer(buf []byte) {
+	if cap(buf) == cipherStreamBufferSize {
+		buf = buf[:cipherStreamBufferSize]
+		bufferPool.Put(&buf)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// writeAtomic calls write with a temporary file beside path, readable only by the owner,
+// then syncs and renames it to path. On any error, the temporary file is removed.
+// It mirrors the unexported helper used by blobcrypt.EncryptFile, for files the CLI writes itself.
+func writeAtomic(path string, write func(io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	// Removal fails harmlessly once the file has been renamed into place.
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
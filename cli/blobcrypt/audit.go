@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// auditDir checks every blob under dir against the key file beside it (BLOB.key), in parallel,
+// and prints a table of results to w. Blobs without a key file, and key files without a blob,
+// are reported as failures so that nothing in a hand-managed folder goes unnoticed.
+// Returns the number of entries that failed.
+func auditDir(dir string, w io.Writer) (int, error) {
+	var entries []*listEntry
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		// Key files, and recipient-wrapped copies of them, are checked along with their blob;
+		// Report only those that have none.
+		for _, suffix := range []string{".key", ".key" + recipientSuffix} {
+			if strings.HasSuffix(path, suffix) {
+				if _, err := os.Stat(strings.TrimSuffix(path, suffix)); os.IsNotExist(err) {
+					entries = append(entries, &listEntry{Path: path, Err: fmt.Errorf("Key file has no blob")})
+				}
+				return nil
+			}
+		}
+
+		entry := &listEntry{Path: path}
+		keyBytes, err := ioutil.ReadFile(path + ".key")
+		if err != nil {
+			entry.Err = fmt.Errorf("No key: %v", err)
+		} else {
+			entry.Key = strings.TrimSpace(string(keyBytes))
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return runChecks(entries, w)
+}
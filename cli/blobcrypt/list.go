@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	blobcrypt "github.com/home-orbit/go-blob-encryption"
+)
+
+// listEntry is one line of a check list: an encrypted file, its key, and optionally its expected HMAC.
+type listEntry struct {
+	Path string
+	Key  string
+	HMAC string
+
+	Err error
+}
+
+// readCheckList parses a check list file. Each non-empty line holds whitespace-separated
+// PATH, KEY and optional HMAC fields, with hex-encoded KEY and HMAC. Lines starting with # are ignored.
+// Relative paths are resolved against the directory containing the list.
+func readCheckList(listPath string) ([]*listEntry, error) {
+	f, err := os.Open(listPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	baseDir := filepath.Dir(listPath)
+	var entries []*listEntry
+
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("%s:%d: expected PATH KEY [HMAC]", listPath, lineNum)
+		}
+
+		entry := &listEntry{Path: fields[0], Key: fields[1]}
+		if len(fields) == 3 {
+			entry.HMAC = fields[2]
+		}
+		if !filepath.IsAbs(entry.Path) {
+			entry.Path = filepath.Join(baseDir, entry.Path)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// checkEntry validates a single list entry, comparing its HMAC if one was provided.
+func checkEntry(entry *listEntry) error {
+	in, err := os.Open(entry.Path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	key, err := blobcrypt.ParseKey(entry.Key)
+	if err != nil {
+		return err
+	}
+
+	result, err := blobcrypt.CheckKeyDetailed(in, key)
+	if err != nil {
+		return err
+	}
+
+	return compareHMAC(entry.HMAC, result.HMAC)
+}
+
+// checkList validates every entry in the list at listPath in parallel, and prints a table of results to w.
+// Returns the number of entries that failed.
+func checkList(listPath string, w io.Writer) (int, error) {
+	entries, err := readCheckList(listPath)
+	if err != nil {
+		return 0, err
+	}
+	return runChecks(entries, w)
+}
+
+// runChecks validates entries in parallel, and prints a table of results to w.
+// Entries that already have an error are reported without being checked.
+// Returns the number of entries that failed.
+func runChecks(entries []*listEntry, w io.Writer) (int, error) {
+	work := make(chan *listEntry)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range work {
+				if entry.Err == nil {
+					entry.Err = checkEntry(entry)
+				}
+			}
+		}()
+	}
+	for _, entry := range entries {
+		work <- entry
+	}
+	close(work)
+	wg.Wait()
+
+	failed := 0
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "RESULT\tFILE\tDETAIL")
+	for _, entry := range entries {
+		if entry.Err != nil {
+			failed++
+			fmt.Fprintf(table, "FAIL\t%s\t%v\n", entry.Path, entry.Err)
+		} else {
+			fmt.Fprintf(table, "OK\t%s\t\n", entry.Path)
+		}
+	}
+	if err := table.Flush(); err != nil {
+		return failed, err
+	}
+
+	_, err := fmt.Fprintf(w, "\n%d checked, %d failed\n", len(entries), failed)
+	return failed, err
+}
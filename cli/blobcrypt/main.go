@@ -1,9 +1,12 @@
 package main
 
 import (
+	"crypto/hmac"
+	"crypto/rsa"
 	"encoding/hex"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -21,7 +24,9 @@ import (
  * the encryption key and decrypt or verify the encrypted output.
  */
 
-func encryptFile(infile, outfile, cs, keyfile string) ([]byte, error) {
+// encryptFile encrypts infile to outfile, or stdout, saving its key to keyfile.
+// If recipient is non-nil, a copy of the key wrapped for recipient is also saved beside keyfile.
+func encryptFile(infile, outfile, cs, keyfile string, recipient *rsa.PublicKey) ([]byte, error) {
 	in, err := os.Open(infile)
 	if err != nil {
 		return nil, err
@@ -34,8 +39,7 @@ func encryptFile(infile, outfile, cs, keyfile string) ([]byte, error) {
 	}
 
 	// Store the key first; If key can't be saved, there's no point in encrypting source.
-	hexKey := hex.EncodeToString(key) + "\n"
-	if err := ioutil.WriteFile(keyfile, []byte(hexKey), 0600); err != nil {
+	if err := writeKeyFiles(keyfile, key, recipient); err != nil {
 		return nil, err
 	}
 
@@ -58,14 +62,35 @@ func encryptFile(infile, outfile, cs, keyfile string) ([]byte, error) {
 	return writer.Encrypt(out)
 }
 
+// writeKeyFiles atomically saves key to keyfile as hex, and if recipient is non-nil,
+// a copy wrapped for recipient beside it.
+func writeKeyFiles(keyfile string, key blobcrypt.Key, recipient *rsa.PublicKey) error {
+	err := writeAtomic(keyfile, func(out io.Writer) error {
+		_, err := io.WriteString(out, key.Hex()+"\n")
+		return err
+	})
+	if err != nil || recipient == nil {
+		return err
+	}
+
+	wrapped, err := wrapKey(key, recipient)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(keyfile+recipientSuffix, func(out io.Writer) error {
+		_, err := out.Write(wrapped)
+		return err
+	})
+}
+
 func decryptFile(infile, outfile, hashstr string) error {
-	in, err := os.Open(infile)
+	in, closeInput, err := openSeekable(infile)
 	if err != nil {
 		return err
 	}
-	defer in.Close()
+	defer closeInput()
 
-	key, err := hex.DecodeString(hashstr)
+	key, err := blobcrypt.ParseKey(hashstr)
 	if err != nil {
 		return err
 	}
@@ -88,20 +113,40 @@ func decryptFile(infile, outfile, hashstr string) error {
 	return reader.Decrypt(out)
 }
 
-func checkFile(infile, hashstr string) error {
-	in, err := os.Open(infile)
+// checkFile validates infile with the given key. If expectHMAC is non-empty, the file's HMAC
+// must also equal it, ensuring infile is the exact blob referenced by an index.
+func checkFile(infile, hashstr, expectHMAC string) error {
+	in, closeInput, err := openSeekable(infile)
 	if err != nil {
 		return err
 	}
-	defer in.Close()
+	defer closeInput()
 
-	key, err := hex.DecodeString(hashstr)
+	key, err := blobcrypt.ParseKey(hashstr)
 	if err != nil {
 		return err
 	}
 
-	_, err = blobcrypt.CheckKey(in, key)
-	return err
+	result, err := blobcrypt.CheckKeyDetailed(in, key)
+	if err != nil {
+		return err
+	}
+	return compareHMAC(expectHMAC, result.HMAC)
+}
+
+// compareHMAC returns an error unless expectedHex is empty or the hex encoding of mac.
+func compareHMAC(expectedHex string, mac []byte) error {
+	if expectedHex == "" {
+		return nil
+	}
+	expected, err := hex.DecodeString(expectedHex)
+	if err != nil {
+		return fmt.Errorf("Expected HMAC is not valid hex: %v", err)
+	}
+	if !hmac.Equal(expected, mac) {
+		return fmt.Errorf("HMAC %x does not match expected HMAC", mac)
+	}
+	return nil
 }
 
 func main() {
@@ -109,10 +154,19 @@ func main() {
 	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	flags.Usage = func() {
 		basename := filepath.Base(os.Args[0])
-		fmt.Println(`Usage: ` + basename + ` [-encrypt|-decrypt|-check] [-keyfile KEYFILE|-key "HEX"] [-cs "secret"] INPUT [OUTPUT]`)
-		fmt.Println(`  INPUT must be a regular file to encrypt or decrypt.`)
+		fmt.Println(`Usage: ` + basename + ` [-encrypt|-decrypt|-check] [-keyfile KEYFILE|-key "HEX"] [-recipient PEMFILE] [-cs "secret"] INPUT [OUTPUT]`)
+		fmt.Println(`       ` + basename + ` -check -list LISTFILE`)
+		fmt.Println(`       ` + basename + ` -tar [-encrypt|-decrypt] [-bundlekey KEYFILE] [-cs "secret"] INPUT [OUTPUT]`)
+		fmt.Println(`       ` + basename + ` -audit DIR`)
+		fmt.Println(`  INPUT must be a regular file to encrypt. When decrypting or checking, INPUT may be`)
+		fmt.Println(`  "-" for stdin or another pipe, which is spooled to a temporary file first;`)
+		fmt.Println(`  The key must then be given with -key or -keyfile.`)
 		fmt.Println(`  If OUTPUT is a directory, the basename of INFILE is appended.`)
 		fmt.Println(`  If OUTPUT is not provided, stdout will be used.`)
+		fmt.Println(`  LISTFILE lines contain "PATH KEY [HMAC]", with hex KEY and HMAC.`)
+		fmt.Println(`  With -tar, INPUT may be a directory and OUTPUT is a tar archive when encrypting;`)
+		fmt.Println(`  If that OUTPUT is a directory, the archive is named after INPUT with ".tar" appended.`)
+		fmt.Println(`  When decrypting, INPUT is the archive and OUTPUT is the directory to extract into, defaulting to ".".`)
 		fmt.Println(``)
 		flags.PrintDefaults()
 	}
@@ -122,9 +176,50 @@ func main() {
 	keyliteral := flags.String("key", "", `The decryption key. If specified, keyfile is ignored.`)
 	cs := flags.String("cs", "", "A Convergence Secret string. For small or sensitive files, a GUID is recommended")
 	keyfile := flags.String("keyfile", "", `File to read or write key. Defaults to OUTPUT.key when encrypting, and INPUT.key when decrypting`)
+	expectHMAC := flags.String("expect-hmac", "", `With -check, also require the file's HMAC to equal this hex value.`)
+	watch := flags.Bool("watch", false, `With -encrypt, keep running and re-encrypt INPUT to OUTPUT whenever it changes.`)
+	list := flags.String("list", "", `With -check, validate every file in LISTFILE in parallel instead of INPUT.`)
+	tarMode := flags.Bool("tar", false, `Encrypt INPUT to, or decrypt INPUT from, a tar archive of individually encrypted files.`)
+	bundlekey := flags.String("bundlekey", "", `With -tar, file holding the key that wraps member keys. Created if missing when encrypting.`)
+	recipientPath := flags.String("recipient", "", `When encrypting, also save the key wrapped for the RSA public key in this PEM file, to KEYFILE.rsa.`)
+	audit := flags.String("audit", "", `Check every file in DIR against the BLOB.key file beside it, and report corruption.`)
 
 	flags.Parse(os.Args[1:])
 
+	if *expectHMAC != "" && (!*check || *list != "") {
+		log.Fatal("-expect-hmac may only be used with -check, and not with -list")
+	}
+	if *watch && (*decrypt || *check || *tarMode) {
+		log.Fatal("-watch may only be used with -encrypt")
+	}
+
+	if *list != "" {
+		if !*check {
+			log.Fatal("-list may only be used with -check")
+		}
+		failed, err := checkList(*list, os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Check Failed: %v\n", err)
+			os.Exit(1)
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *audit != "" {
+		failed, err := auditDir(*audit, os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Audit Failed: %v\n", err)
+			os.Exit(1)
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
 	if flags.NArg() < 1 {
 		flags.Usage()
 		fmt.Println(`Source and Destination files must be specified.`)
@@ -132,33 +227,87 @@ func main() {
 	}
 	inPath := flags.Arg(0)
 	outPath := flags.Arg(1)
+
+	if (*encrypt && *decrypt) || (*encrypt && *check) || (*decrypt && *check) {
+		log.Fatal("Only one of -encrypt, -decrypt, or -check may be specified")
+	}
+	if !(*encrypt || *decrypt || *check) {
+		*encrypt = true
+	}
+
 	if outPath != "" {
 		if stat, err := os.Stat(outPath); err == nil {
-			if stat.IsDir() {
+			// When extracting an archive, OUTPUT is the directory to extract into.
+			if stat.IsDir() && !(*tarMode && !*encrypt) {
 				inBase := filepath.Base(inPath)
+				if *tarMode {
+					inBase += ".tar"
+				}
 				outPath = filepath.Join(outPath, inBase)
 			}
 		}
 	}
 
-	if (*encrypt && *decrypt) || (*encrypt && *check) || (*decrypt && *check) {
-		log.Fatal("Only one of -encrypt, -decrypt, or -check may be specified")
-	}
-	if !(*encrypt || *decrypt || *check) {
-		*encrypt = true
+	if *tarMode {
+		if *check {
+			log.Fatal("-check may not be used with -tar")
+		}
+		bundleKey, err := loadBundleKey(*bundlekey, *encrypt)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading bundle key: %v\n", err)
+			os.Exit(1)
+		}
+		if bundleKey == nil && *encrypt {
+			fmt.Fprintln(os.Stderr, "Warning: No -bundlekey specified; Member keys are stored unwrapped in the archive.")
+		}
+
+		if *encrypt {
+			err = encryptTar(inPath, outPath, *cs, bundleKey)
+		} else {
+			if outPath == "" {
+				outPath = "."
+			}
+			err = decryptTar(inPath, outPath, bundleKey)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Archive Failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
 
 	if *encrypt {
 		if *keyfile == "" {
 			*keyfile = outPath + ".key"
 		}
+		var recipient *rsa.PublicKey
+		if *recipientPath != "" {
+			var err error
+			if recipient, err = loadRecipient(*recipientPath); err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading recipient: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if *watch {
+			if outPath == "" {
+				log.Fatal("-watch requires OUTPUT")
+			}
+			if err := watchFile(inPath, outPath, *cs, *keyfile, recipient); err != nil {
+				fmt.Fprintf(os.Stderr, "Watch Failed: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
 		// TODO: Decide whether HMAC should be captured and/or displayed
-		if _, err := encryptFile(inPath, outPath, *cs, *keyfile); err != nil {
+		if _, err := encryptFile(inPath, outPath, *cs, *keyfile, recipient); err != nil {
 			fmt.Fprintf(os.Stderr, "Encryption Failed: %v\n", err)
 			os.Exit(1)
 		}
 	} else {
-		if *keyfile == "" {
+		if *keyfile == "" && *keyliteral == "" {
+			if inPath == "-" {
+				log.Fatal("-key or -keyfile is required when INPUT is stdin")
+			}
 			*keyfile = inPath + ".key"
 		}
 		if *keyliteral == "" {
@@ -176,7 +325,7 @@ func main() {
 				os.Exit(1)
 			}
 		} else if *check {
-			if err := checkFile(inPath, *keyliteral); err != nil {
+			if err := checkFile(inPath, *keyliteral, *expectHMAC); err != nil {
 				fmt.Fprintf(os.Stderr, "Check Failed: %v\n", err)
 				os.Exit(1)
 			}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// recipientSuffix is appended to the keyfile path to name the recipient-wrapped copy of the key.
+const recipientSuffix = ".rsa"
+
+// minRecipientBits is the smallest RSA modulus accepted for a recipient key.
+const minRecipientBits = 2048
+
+// loadRecipient reads an RSA public key from a PEM file, in PKIX ("PUBLIC KEY") or PKCS #1
+// ("RSA PUBLIC KEY") form.
+func loadRecipient(path string) (*rsa.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "age1") {
+		return nil, fmt.Errorf("%s: age recipients are not supported; Use an RSA public key in PEM format", path)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: No PEM data found", path)
+	}
+
+	var pub *rsa.PublicKey
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if pub, ok = key.(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf("%s: Public key is not an RSA key", path)
+		}
+	case "RSA PUBLIC KEY":
+		if pub, err = x509.ParsePKCS1PublicKey(block.Bytes); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%s: Unsupported PEM type %q", path, block.Type)
+	}
+
+	if pub.N.BitLen() < minRecipientBits {
+		return nil, fmt.Errorf("%s: RSA key is %d bits; At least %d are required", path, pub.N.BitLen(), minRecipientBits)
+	}
+	return pub, nil
+}
+
+// wrapKey encrypts key to pub with RSA-OAEP over SHA256 and no label, returning it as a line of base64.
+// The result can be unwrapped with any OAEP implementation, eg. openssl pkeyutl.
+func wrapKey(key []byte, pub *rsa.PublicKey) ([]byte, error) {
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(wrapped) + "\n"), nil
+}
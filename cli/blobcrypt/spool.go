@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// openSeekable opens path for reading, returning a seekable file.
+// If path is "-", standard input is used. Input that is not a regular file (a pipe, socket or FIFO)
+// is spooled to a temporary file on disk, so ciphertext can be verified before it is decrypted
+// without buffering it in memory. The returned close function removes any temporary file.
+func openSeekable(path string) (*os.File, func(), error) {
+	in := os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		in = f
+	}
+
+	stat, err := in.Stat()
+	if err != nil {
+		in.Close()
+		return nil, nil, err
+	}
+	if stat.Mode().IsRegular() {
+		return in, func() { in.Close() }, nil
+	}
+	defer in.Close()
+
+	spool, err := ioutil.TempFile("", "blobcrypt-spool-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+
+	if _, err := io.Copy(spool, in); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return spool, cleanup, nil
+}
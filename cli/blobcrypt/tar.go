@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	blobcrypt "github.com/home-orbit/go-blob-encryption"
+	"github.com/home-orbit/go-blob-encryption/blobtar"
+)
+
+// loadBundleKey reads the hex bundle key from path. If create is set and path does not exist,
+// a random key is generated and saved there. An empty path means member keys are not wrapped.
+func loadBundleKey(path string, create bool) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	keyBytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && create {
+		key := make(blobcrypt.Key, blobcrypt.KeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		return key, ioutil.WriteFile(path, []byte(key.Hex()+"\n"), 0600)
+	} else if err != nil {
+		return nil, err
+	}
+	return blobcrypt.ParseKey(strings.TrimSpace(string(keyBytes)))
+}
+
+// encryptTar writes every regular file at or beneath inPath to a tar archive at outfile
+// (or stdout), each member encrypted individually. Member names are relative to the parent of inPath.
+// The archive is replaced atomically, so a failure leaves no partial archive at outfile.
+func encryptTar(inPath, outfile, cs string, bundleKey []byte) error {
+	if outfile == "" {
+		return writeTar(os.Stdout, inPath, cs, bundleKey)
+	}
+
+	var previous os.FileInfo
+	if stat, err := os.Stat(outfile); err == nil {
+		previous = stat
+	}
+	return writeAtomic(outfile, func(out io.Writer) error {
+		return writeTar(out.(*os.File), inPath, cs, bundleKey, previous)
+	})
+}
+
+// writeTar writes the archive for inPath to out. Output may be inside inPath, so out itself
+// and any skip files are left out of the archive, rather than archiving the growing output.
+func writeTar(out *os.File, inPath, cs string, bundleKey []byte, skip ...os.FileInfo) error {
+	if stat, err := out.Stat(); err == nil {
+		skip = append(skip, stat)
+	}
+
+	archive := blobtar.NewWriter(out, bundleKey)
+	baseDir := filepath.Dir(filepath.Clean(inPath))
+
+	err := filepath.Walk(inPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		for _, skipped := range skip {
+			if skipped != nil && os.SameFile(info, skipped) {
+				return nil
+			}
+		}
+
+		name, err := filepath.Rel(baseDir, path)
+		if err != nil {
+			return err
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		_, err = archive.Add(filepath.ToSlash(name), in, cs, info.ModTime())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// decryptTar verifies and decrypts every member of the archive at infile (or "-" for stdin)
+// into outDir, refusing member names that would escape it.
+func decryptTar(infile, outDir string, bundleKey []byte) error {
+	in := os.Stdin
+	if infile != "-" {
+		f, err := os.Open(infile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	archive := blobtar.NewReader(in, bundleKey)
+	for {
+		member, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		name := filepath.FromSlash(member.Header.Name)
+		if filepath.IsAbs(name) || strings.HasPrefix(filepath.Clean(name), "..") {
+			return fmt.Errorf("%s: member name is outside the output directory", member.Header.Name)
+		}
+
+		outPath := filepath.Join(outDir, name)
+		if err := os.MkdirAll(filepath.Dir(outPath), 0700); err != nil {
+			return err
+		}
+		if err := decryptMember(member, outPath); err != nil {
+			return fmt.Errorf("%s: %v", member.Header.Name, err)
+		}
+	}
+}
+
+func decryptMember(member *blobtar.Member, outPath string) error {
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if err := member.Decrypt(out); err != nil {
+		os.Remove(outPath)
+		return err
+	}
+	return os.Chtimes(outPath, member.Header.ModTime, member.Header.ModTime)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/rsa"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	blobcrypt "github.com/home-orbit/go-blob-encryption"
+)
+
+const (
+	// watchInterval is how often INPUT is checked for changes.
+	watchInterval = time.Second
+	// watchDebounce is how long INPUT must remain unchanged before it is re-encrypted,
+	// so that a file being written is not encrypted mid-write.
+	watchDebounce = 2 * time.Second
+)
+
+// watchFile encrypts infile to outfile, then re-encrypts it whenever its size or modification
+// time changes and has been stable for watchDebounce. Output and key files are replaced atomically,
+// so readers never see a partial blob. If recipient is non-nil, the wrapped key file is also replaced.
+// Runs until the process is interrupted.
+func watchFile(infile, outfile, cs, keyfile string, recipient *rsa.PublicKey) error {
+	var lastStat, pendingStat os.FileInfo
+	var pendingSince time.Time
+
+	for ; ; time.Sleep(watchInterval) {
+		stat, err := os.Stat(infile)
+		if err != nil {
+			log.Printf("Watch: %v", err)
+			continue
+		}
+
+		if lastStat != nil && sameFileState(stat, lastStat) {
+			pendingStat = nil
+			continue
+		}
+
+		// Restart the debounce period whenever the file changes again.
+		if pendingStat == nil || !sameFileState(stat, pendingStat) {
+			pendingStat, pendingSince = stat, time.Now()
+		}
+		if lastStat != nil && time.Since(pendingSince) < watchDebounce {
+			continue
+		}
+
+		keyErr, err := encryptWatched(infile, outfile, cs, keyfile, recipient)
+		if keyErr != nil {
+			return keyErr
+		} else if err != nil {
+			log.Printf("Watch: Encryption Failed: %v", err)
+			continue
+		}
+
+		log.Printf("Watch: Encrypted %s to %s", infile, outfile)
+		lastStat, pendingStat = stat, nil
+	}
+}
+
+// encryptWatched encrypts infile to a temporary file beside outfile, and stores its key before
+// renaming the output into place, so outfile is never replaced by a blob whose key wasn't saved.
+// If the key can't be saved, outfile is left unchanged. The output is synced before the key is saved,
+// but the two renames are not atomic together: If the final rename of outfile fails, the new key
+// is left beside the old blob until the next successful encryption. Errors saving the key are
+// returned as keyErr.
+func encryptWatched(infile, outfile, cs, keyfile string, recipient *rsa.PublicKey) (keyErr, err error) {
+	in, err := os.Open(infile)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	key, err := blobcrypt.ComputeKey(in, cs)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := blobcrypt.NewWriter(in, key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeAtomic(outfile, func(out io.Writer) error {
+		if _, err := writer.Encrypt(out); err != nil {
+			return err
+		}
+		// Sync now, so that only the rename can fail once the new key is in place.
+		if err := out.(*os.File).Sync(); err != nil {
+			return err
+		}
+		keyErr = writeKeyFiles(keyfile, key, recipient)
+		return keyErr
+	})
+	return keyErr, err
+}
+
+func sameFileState(a, b os.FileInfo) bool {
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
@@ -0,0 +1,16 @@
+// Package blobcrypt encrypts and decrypts large files using a key derived from the file's own content,
+// so that identical inputs always produce identical encrypted blobs.
+//
+// # API Stability
+//
+// As of v1, the following are stable and will only change in backward-compatible ways:
+// Key and ParseKey, ComputeKey, ComputeKeyFromDigest, CheckKey, CheckKeyStrict, ComputeHMAC, NewMAC,
+// NewWriter, NewReader, the Writer and Reader methods, Option and the With* option functions,
+// the Suite registry, Keychain and KeyStore, ChunkKey, EncryptBytes/DecryptBytes,
+// EncryptFile/DecryptFile, Checkpoint and its serialized form,
+// and Inspect with the format constants KeySize, MACSize and IVSize.
+// New configuration is added as Option functions rather than new constructors.
+//
+// CipherStream is exported for advanced use, but its fields and methods may change between minor versions.
+// Functions marked Deprecated remain available until the next major version.
+package blobcrypt
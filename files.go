@@ -0,0 +1,80 @@
+package blobcrypt
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// EncryptFile encrypts the file at inPath to outPath, using a key computed with convergence secret cs.
+// Output is written to a temporary file beside outPath and renamed into place only on success,
+// so outPath never contains a partial blob. The output is created readable only by its owner.
+//
+// Returns the key needed to decrypt outPath, and the HMAC of the encrypted output.
+func EncryptFile(inPath, outPath, cs string, opts ...Option) (key Key, mac []byte, err error) {
+	in, err := os.Open(inPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer in.Close()
+
+	if key, err = ComputeKey(in, cs); err != nil {
+		return nil, nil, err
+	}
+
+	writer, err := NewWriter(in, key, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = writeAtomic(outPath, func(out io.Writer) error {
+		mac, err = writer.Encrypt(out)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, mac, nil
+}
+
+// DecryptFile verifies and decrypts the file at inPath to outPath using key.
+// As with EncryptFile, outPath is only replaced once decryption has completed successfully.
+func DecryptFile(inPath, outPath string, key []byte, opts ...Option) error {
+	in, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	reader, err := NewReader(in, key, opts...)
+	if err != nil {
+		return err
+	}
+
+	return writeAtomic(outPath, reader.Decrypt)
+}
+
+// writeAtomic calls write with a temporary file in the same directory as path,
+// then renames the temporary file to path. On any error, the temporary file is removed.
+func writeAtomic(path string, write func(io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	// Removal fails harmlessly once the file has been renamed into place.
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,64 @@
+package blobcrypt
+
+import (
+	"crypto/aes"
+	"crypto/sha512"
+	"io"
+)
+
+// Format constants for blobs written with DefaultSuite.
+// A blob is the encrypted body followed immediately by an HMAC suffix; There is no header.
+const (
+	// MACSize is the length of the HMAC suffix.
+	MACSize = sha512.Size
+	// IVSize is the length of the CTR initialization vector, taken from the start of SHA256(key).
+	IVSize = aes.BlockSize
+)
+
+// Layout describes the location of each part of an encrypted blob.
+type Layout struct {
+	// Size is the total size of the blob.
+	Size int64
+	// BodyOffset and BodySize locate the encrypted content. BodyOffset is always zero.
+	BodyOffset int64
+	BodySize   int64
+	// MACOffset and MACSize locate the HMAC suffix, which is the blob's identity.
+	MACOffset int64
+	MACSize   int
+}
+
+// Inspect returns the layout of the blob in source, without reading its content or requiring its key.
+// Only the WithCipher option applies, selecting the suite whose MAC size determines the layout.
+// Returns ErrTooShort if source cannot contain an HMAC suffix.
+func Inspect(source io.Seeker, opts ...Option) (Layout, error) {
+	size, err := source.Seek(0, io.SeekEnd)
+	if err != nil {
+		return Layout{}, err
+	}
+	if _, err := source.Seek(0, io.SeekStart); err != nil {
+		return Layout{}, err
+	}
+	return InspectSize(size, opts...)
+}
+
+// InspectSize returns the layout of a blob of the given size, as Inspect does.
+// This is useful when only a size is known, such as from a directory listing or object store.
+func InspectSize(size int64, opts ...Option) (Layout, error) {
+	suite, err := LookupSuite(newOptions(opts).suite)
+	if err != nil {
+		return Layout{}, err
+	}
+
+	// MAC sizes do not depend on the key, so any valid key will do.
+	macSize := suite.NewMAC(make([]byte, KeySize)).Size()
+	if size < int64(macSize) {
+		return Layout{}, ErrTooShort
+	}
+
+	return Layout{
+		Size:      size,
+		BodySize:  size - int64(macSize),
+		MACOffset: size - int64(macSize),
+		MACSize:   macSize,
+	}, nil
+}
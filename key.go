@@ -0,0 +1,88 @@
+package blobcrypt
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// KeySize is the length of a blob encryption key in bytes.
+const KeySize = sha256.Size
+
+// Key is a blob encryption key.
+//
+// Key is a byte slice, so it may be passed anywhere a []byte key is accepted.
+// It is redacted when formatted with any fmt verb, including %x, so keys are not accidentally
+// written to logs or saved as placeholder text; Use Hex or MarshalText to serialize a key deliberately.
+type Key []byte
+
+// ParseKey parses a hex or standard base64 encoded key, and validates its length.
+func ParseKey(s string) (Key, error) {
+	var k Key
+	if err := k.UnmarshalText([]byte(s)); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Validate returns an error if k is not exactly KeySize bytes long.
+func (k Key) Validate() error {
+	if len(k) != KeySize {
+		return fmt.Errorf("Key size is incorrect")
+	}
+	return nil
+}
+
+// Equal reports whether k and other are the same key, in constant time.
+func (k Key) Equal(other Key) bool {
+	return subtle.ConstantTimeCompare(k, other) == 1
+}
+
+// Hex returns the key as a lowercase hex string, as stored in .key files.
+func (k Key) Hex() string {
+	return hex.EncodeToString(k)
+}
+
+// String returns a redacted placeholder, never the key itself.
+func (k Key) String() string {
+	return "Key(REDACTED)"
+}
+
+// GoString returns a redacted placeholder for the %#v verb.
+func (k Key) GoString() string {
+	return k.String()
+}
+
+// Format implements fmt.Formatter, printing the redacted placeholder for every verb.
+// Without it, %x and %X would print the placeholder's own hex encoding, which could be
+// mistaken for a key.
+func (k Key) Format(f fmt.State, verb rune) {
+	f.Write([]byte(k.String()))
+}
+
+// MarshalText encodes the key as hex.
+func (k Key) MarshalText() ([]byte, error) {
+	if err := k.Validate(); err != nil {
+		return nil, err
+	}
+	return []byte(k.Hex()), nil
+}
+
+// UnmarshalText decodes a hex or standard base64 encoded key, and validates its length.
+func (k *Key) UnmarshalText(text []byte) error {
+	decoded, err := hex.DecodeString(string(text))
+	if err != nil || len(decoded) != KeySize {
+		decoded, err = base64.StdEncoding.DecodeString(string(text))
+		if err != nil {
+			return fmt.Errorf("Key is not valid hex or base64")
+		}
+	}
+
+	if err := Key(decoded).Validate(); err != nil {
+		return err
+	}
+	*k = decoded
+	return nil
+}
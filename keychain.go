@@ -0,0 +1,151 @@
+package blobcrypt
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// KeyStore persists the contents of a Keychain.
+// Implementations may use any storage; JSONKeyStore is provided for simple file-based use.
+type KeyStore interface {
+	// Load returns all stored keys, indexed by blob HMAC.
+	Load() (map[string][]byte, error)
+	// Save replaces the stored keys with the given set, indexed by blob HMAC.
+	Save(keys map[string][]byte) error
+}
+
+// Keychain maps the HMACs of encrypted blobs to the keys needed to decrypt them.
+// It is safe for concurrent use. The zero value is an empty, memory-only Keychain;
+// Use NewKeychain to populate a Keychain from its Store.
+type Keychain struct {
+	Store KeyStore
+
+	mu   sync.RWMutex
+	keys map[string][]byte
+}
+
+// NewKeychain returns a Keychain populated from store.
+// If store is nil, the Keychain is memory-only and Save is a no-op.
+func NewKeychain(store KeyStore) (*Keychain, error) {
+	k := &Keychain{Store: store, keys: map[string][]byte{}}
+	if store == nil {
+		return k, nil
+	}
+
+	keys, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	for mac, key := range keys {
+		k.keys[mac] = key
+	}
+	return k, nil
+}
+
+// Add records key as the key for the blob whose HMAC is mac.
+func (k *Keychain) Add(mac, key []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.keys == nil {
+		k.keys = map[string][]byte{}
+	}
+	k.keys[string(mac)] = append([]byte(nil), key...)
+}
+
+// Lookup returns a copy of the key for the blob whose HMAC is mac, if known.
+func (k *Keychain) Lookup(mac []byte) ([]byte, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[string(mac)]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), key...), true
+}
+
+// Remove forgets the key for the blob whose HMAC is mac.
+func (k *Keychain) Remove(mac []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.keys, string(mac))
+}
+
+// Len returns the number of keys in the Keychain.
+func (k *Keychain) Len() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.keys)
+}
+
+// Save writes the contents of the Keychain to its Store.
+func (k *Keychain) Save() error {
+	if k.Store == nil {
+		return nil
+	}
+
+	k.mu.RLock()
+	keys := make(map[string][]byte, len(k.keys))
+	for mac, key := range k.keys {
+		keys[mac] = key
+	}
+	k.mu.RUnlock()
+
+	return k.Store.Save(keys)
+}
+
+// JSONKeyStore is a KeyStore backed by a JSON object of hex-encoded HMACs and keys.
+type JSONKeyStore struct {
+	Path string
+}
+
+// Load reads keys from the JSON file at Path. A missing file is treated as empty.
+func (s JSONKeyStore) Load() (map[string][]byte, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string][]byte{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var encoded map[string]string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string][]byte, len(encoded))
+	for hexMAC, hexKey := range encoded {
+		mac, err := hex.DecodeString(hexMAC)
+		if err != nil {
+			return nil, err
+		}
+		key, err := hex.DecodeString(hexKey)
+		if err != nil {
+			return nil, err
+		}
+		keys[string(mac)] = key
+	}
+	return keys, nil
+}
+
+// Save writes keys to the JSON file at Path, readable only by the owner.
+// The file is replaced atomically, so an interrupted Save leaves the previous keys intact.
+func (s JSONKeyStore) Save(keys map[string][]byte) error {
+	encoded := make(map[string]string, len(keys))
+	for mac, key := range keys {
+		encoded[hex.EncodeToString([]byte(mac))] = hex.EncodeToString(key)
+	}
+
+	data, err := json.MarshalIndent(encoded, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeAtomic(s.Path, func(out io.Writer) error {
+		_, err := out.Write(append(data, '\n'))
+		return err
+	})
+}
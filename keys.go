@@ -4,10 +4,21 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"crypto/sha512"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 )
 
+var (
+	// ErrTooShort indicates a source is too short to contain an HMAC suffix.
+	ErrTooShort = errors.New("File is too short to contain a signature")
+	// ErrEmptyBody indicates a source contains an HMAC suffix, but no encrypted content. Only returned in strict mode.
+	ErrEmptyBody = errors.New("File has no encrypted content")
+	// ErrHMACMismatch indicates the embedded HMAC does not match the content and key.
+	ErrHMACMismatch = errors.New("File signature invalid (HMAC)")
+)
+
 // ComputeKey returns the encryption key to be used for an unencrypted source,
 // or an error if one occurred.
 //
@@ -18,62 +29,99 @@ import (
 // For files that are small, sensitive, or may contain unexpectedly low entropy
 // (eg, a large PDF with just a few sensitive characters in it, like a bank PIN)
 // a strong convergence secret like a GUID should always be used.
-func ComputeKey(source io.ReadSeeker, cs string) ([]byte, error) {
-	sha := sha256.New()
-	sha.Write([]byte(cs))
-	if _, err := io.Copy(sha, source); err != nil {
+func ComputeKey(source io.ReadSeeker, cs string) (Key, error) {
+	return ComputeKeyHash(source, cs, sha256.New)
+}
+
+// ComputeKeyHash behaves like ComputeKey, but hashes the convergence secret and source with
+// a caller-provided hash function, such as BLAKE3 from a third-party package, which must
+// produce KeySize bytes.
+//
+// The choice of hash is not recorded in the encrypted output; Keys computed with different
+// hashes are unrelated, so every party that derives keys for a source must agree on the hash.
+func ComputeKeyHash(source io.ReadSeeker, cs string, newHash func() hash.Hash) (Key, error) {
+	h := newHash()
+	if h.Size() != KeySize {
+		return nil, fmt.Errorf("Hash size must be %d bytes", KeySize)
+	}
+
+	h.Write([]byte(cs))
+	if _, err := io.Copy(h, source); err != nil {
 		return nil, err
 	}
-	hash := sha.Sum(nil)
+	sum := h.Sum(nil)
 
 	// Reset source position before returning the key
 	_, err := source.Seek(0, io.SeekStart)
-	return hash[:], err
+	return Key(sum), err
+}
+
+// ComputeKeyFromDigest returns the encryption key for a source whose SHA256 digest is already known,
+// avoiding a second read of the source.
+//
+// Because the convergence secret is hashed as a prefix of the source, a key that uses a secret
+// cannot be derived from the digest alone; If cs is non-empty, an error is returned
+// and ComputeKey must be used instead.
+func ComputeKeyFromDigest(sha256Digest []byte, cs string) (Key, error) {
+	if len(sha256Digest) != sha256.Size {
+		return nil, fmt.Errorf("Digest size is incorrect")
+	}
+	if cs != "" {
+		return nil, fmt.Errorf("Key cannot be derived from a digest when a convergence secret is used")
+	}
+	return append(Key(nil), sha256Digest...), nil
 }
 
 // CheckKey checks an io.ReadSeeker (a file, etc.) for internal consistency,
 // and ensures that the given key matches the embedded signature.
 // A valid source has a trailer with an HMAC for the given key and the preceding, encrypted bytes.
+// WithCipher selects the suite the source was encrypted with, and WithStrict applies CheckKeyStrict's rules;
+// Other options are ignored. In particular, WithArmor has no effect, so source must be the raw blob.
 //
 // Returns the offset at which the validated, encrypted content ends, or an error if one occurred.
-func CheckKey(source io.ReadSeeker, key []byte) (int64, error) {
-	iv := shaSlice256(key)
-	hmacKey := shaSlice256(iv)
-
-	mac := hmac.New(sha512.New, hmacKey)
-	macSize := int64(mac.Size())
-
-	// Skip to the correct number of bytes from the end of the file.
-	trailerPos, err := source.Seek(-macSize, io.SeekEnd)
-	if err != nil {
-		return 0, err
-	}
-
-	// Read the embedded HMAC value
-	embeddedHMAC := make([]byte, mac.Size())
-	// Docs indicate it's possible to get correct data and EOF in a single call.
-	if l, err := source.Read(embeddedHMAC); l != len(embeddedHMAC) && err != nil {
-		return 0, err
-	}
+func CheckKey(source io.ReadSeeker, key []byte, opts ...Option) (int64, error) {
+	return checkKey(source, key, opts...)
+}
 
-	// Return to the beginning of the file and start scanning
-	if _, err = source.Seek(0, io.SeekStart); err != nil {
-		return 0, err
-	}
+// CheckKeyStrict behaves like CheckKey with WithStrict, rejecting blobs with no encrypted content.
+// Intended for servers validating untrusted uploads, where a malformed layout should be reported specifically.
+//
+// The HMAC suffix is always the final bytes of a blob, so trailing data appended after it
+// cannot be distinguished from a corrupt signature, and is reported as ErrHMACMismatch.
+func CheckKeyStrict(source io.ReadSeeker, key []byte, opts ...Option) (int64, error) {
+	// Copy opts, so the caller's backing array is never written to.
+	strictOpts := make([]Option, 0, len(opts)+1)
+	strictOpts = append(append(strictOpts, opts...), WithStrict())
+	return checkKey(source, key, strictOpts...)
+}
 
-	// Use a LimitReader that stops before the final HMAC suffix
-	bodyReader := io.LimitReader(source, trailerPos)
-	if _, err := io.Copy(mac, bodyReader); err != nil {
+func checkKey(source io.ReadSeeker, key []byte, opts ...Option) (int64, error) {
+	result, err := CheckKeyDetailed(source, key, opts...)
+	var checkErr *CheckError
+	if errors.As(err, &checkErr) {
+		// Preserve the plain errors returned before CheckKeyDetailed existed.
+		return 0, checkErr.Err
+	} else if err != nil {
 		return 0, err
 	}
-	bodyHMAC := mac.Sum(nil)
+	return result.BodySize, nil
+}
 
-	// Require the embedded HMAC to match the one we just calculated.
-	if !hmac.Equal(bodyHMAC, embeddedHMAC) {
-		return 0, fmt.Errorf("File signature invalid (HMAC)")
+// ComputeHMAC returns the HMAC of encrypted content read from source until EOF, using key.
+// Unlike CheckKey, source must not include the HMAC suffix, and no comparison is made;
+// This allows the HMAC of a blob to be recomputed when its trailer is stored elsewhere.
+func ComputeHMAC(source io.Reader, key []byte) ([]byte, error) {
+	mac := NewMAC(key)
+	if _, err := io.Copy(mac, source); err != nil {
+		return nil, err
 	}
+	return mac.Sum(nil), nil
+}
 
-	// Reset source position before returning trailer offset
-	_, err = source.Seek(0, io.SeekStart)
-	return trailerPos, err
+// NewMAC returns the HMAC used to sign content encrypted with key.
+// Writing the encrypted body to it and calling Sum yields the blob's HMAC suffix.
+func NewMAC(key []byte) hash.Hash {
+	iv := shaSlice256(key)
+	hmacKey := shaSlice256(iv)
+	return hmac.New(sha512.New, hmacKey)
 }
@@ -0,0 +1,55 @@
+package blobcrypt
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrSizeLimit is returned by the in-memory helpers when a payload exceeds the caller's limit.
+var ErrSizeLimit = errors.New("Payload exceeds size limit")
+
+// EncryptBytes encrypts a small in-memory payload, such as a manifest or token.
+// The payload must be no larger than limit bytes, or ErrSizeLimit is returned.
+//
+// Returns the encrypted bytes (including the HMAC suffix) and the key needed to decrypt them.
+func EncryptBytes(plaintext []byte, cs string, limit int) (ciphertext []byte, key Key, err error) {
+	if len(plaintext) > limit {
+		return nil, nil, ErrSizeLimit
+	}
+
+	source := bytes.NewReader(plaintext)
+	if key, err = ComputeKey(source, cs); err != nil {
+		return nil, nil, err
+	}
+
+	writer, err := NewWriter(source, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var output bytes.Buffer
+	output.Grow(len(plaintext) + MACSize)
+	if _, err := writer.Encrypt(&output); err != nil {
+		return nil, nil, err
+	}
+	return output.Bytes(), key, nil
+}
+
+// DecryptBytes decrypts an in-memory payload produced by EncryptBytes or a Writer.
+// The decrypted content must be no larger than limit bytes, or ErrSizeLimit is returned.
+func DecryptBytes(ciphertext, key []byte, limit int) ([]byte, error) {
+	if len(ciphertext)-MACSize > limit {
+		return nil, ErrSizeLimit
+	}
+
+	reader, err := NewReader(bytes.NewReader(ciphertext), key)
+	if err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	if err := reader.Decrypt(&output); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
@@ -0,0 +1,86 @@
+package blobcrypt
+
+import "context"
+
+// Option configures a Writer or Reader at construction.
+type Option func(*options)
+
+type options struct {
+	suite       SuiteID
+	bufferSize  int
+	progress    func(int64)
+	ctx         context.Context
+	synchronous bool
+	strict      bool
+	armor       bool
+
+	checkpoint         func(Checkpoint)
+	checkpointInterval int64
+}
+
+func newOptions(opts []Option) options {
+	o := options{ctx: context.Background()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithCipher selects the registered cipher suite used to encrypt or decrypt. The default is DefaultSuite.
+func WithCipher(id SuiteID) Option {
+	return func(o *options) { o.suite = id }
+}
+
+// WithBufferSize sets the size of the blocks read from the source and written to the output.
+func WithBufferSize(size int) Option {
+	return func(o *options) { o.bufferSize = size }
+}
+
+// WithProgress registers a function that is called with the total number of content bytes
+// written to the output so far, each time a block is written. The HMAC suffix is not counted.
+func WithProgress(fn func(total int64)) Option {
+	return func(o *options) { o.progress = fn }
+}
+
+// WithContext allows encryption or decryption to be canceled.
+// When ctx is done, Encrypt and Decrypt stop and return its error.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) { o.ctx = ctx }
+}
+
+// WithSynchronous runs encryption or decryption entirely in the caller's goroutine.
+func WithSynchronous() Option {
+	return func(o *options) { o.synchronous = true }
+}
+
+// WithStrict causes NewReader to validate its source with CheckKeyStrict. It has no effect on Writers.
+func WithStrict() Option {
+	return func(o *options) { o.strict = true }
+}
+
+// WithArmor causes Writers to produce ASCII-armored output (see ArmorWriter), and Readers to expect it.
+// Armored Readers decode their entire source into memory, so this is only suitable for small payloads.
+func WithArmor() Option {
+	return func(o *options) { o.armor = true }
+}
+
+// WithCheckpoints causes Writers to call fn with a Checkpoint each time another interval bytes
+// of content have been written to the output, so that an interrupted encryption, such as an
+// upload, can be continued with EncryptResume. Checkpoints are taken at block boundaries,
+// after the block is written. Only DefaultSuite supports checkpoints, and not with WithArmor.
+func WithCheckpoints(interval int64, fn func(Checkpoint)) Option {
+	return func(o *options) {
+		if interval > 0 {
+			o.checkpoint = fn
+			o.checkpointInterval = interval
+		}
+	}
+}
+
+// contextOrBackground returns ctx, or a background context for Writers and Readers built without a constructor.
+func contextOrBackground(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
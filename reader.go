@@ -1,55 +1,94 @@
 package blobcrypt
 
 import (
+	"bytes"
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
 	"io"
+	"io/ioutil"
 )
 
 // Reader decrypts the contents of an underlying io.Reader
 type Reader struct {
 	Source io.Reader
 	Key    []byte
+
+	// Suite selects the registered cipher suite used for decryption. The zero value is DefaultSuite.
+	Suite SuiteID
+
+	// Synchronous runs decryption entirely in the caller's goroutine, with no background reads.
+	Synchronous bool
+
+	bufferSize int
+	progress   func(int64)
+	ctx        context.Context
 }
 
-// NewReader returns a new Reader IFF source is valid and key matches.
-func NewReader(source io.ReadSeeker, key []byte) (*Reader, error) {
-	offset, err := CheckKey(source, key)
+// NewReader returns a new Reader IFF source is valid and key matches, configured by opts.
+func NewReader(source io.ReadSeeker, key []byte, opts ...Option) (*Reader, error) {
+	o := newOptions(opts)
+	if o.armor {
+		// Armor is intended for small payloads, so decode the whole source into memory to regain seeking.
+		decoded, err := ioutil.ReadAll(NewArmorReader(source))
+		if err != nil {
+			return nil, err
+		}
+		source = bytes.NewReader(decoded)
+	}
+
+	offset, err := checkKey(source, key, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return &Reader{
-		Source: io.LimitReader(source, offset),
-		Key:    key,
+		Source:      io.LimitReader(source, offset),
+		Key:         key,
+		Suite:       o.suite,
+		Synchronous: o.synchronous,
+		bufferSize:  o.bufferSize,
+		progress:    o.progress,
+		ctx:         o.ctx,
 	}, nil
 }
 
 // Decrypt copies the decrypted content to the provided io.Writer.
 func (r *Reader) Decrypt(w io.Writer) error {
-	iv := shaSlice256(r.Key)
+	_, err := r.WriteTo(w)
+	return err
+}
 
-	blockCipher, err := aes.NewCipher(r.Key)
+// WriteTo copies the decrypted content to w, implementing io.WriterTo.
+// Returns the number of bytes written to w.
+func (r *Reader) WriteTo(w io.Writer) (int64, error) {
+	suite, err := LookupSuite(r.Suite)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	// Configure a cancelable context, ensuring goroutines won't be leaked on early return.
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	stream, err := suite.NewStream(r.Key)
+	if err != nil {
+		return 0, err
+	}
 
 	cipherStream := CipherStream{
-		Source: r.Source,
-		Cipher: cipher.NewCTR(blockCipher, iv[:blockCipher.BlockSize()]),
+		Source:      r.Source,
+		Cipher:      stream,
+		Synchronous: r.Synchronous,
+		BufferSize:  r.bufferSize,
 	}
 
-	// Decrypt in parallel with output.
-	for buf := range cipherStream.Stream(ctx) {
-		if _, err := w.Write(buf); err != nil {
+	// Decrypt to output, in parallel unless Synchronous is set.
+	var total int64
+	err = cipherStream.Each(contextOrBackground(r.ctx), func(buf []byte) error {
+		n, err := w.Write(buf)
+		total += int64(n)
+		if err != nil {
 			return err
 		}
-	}
 
-	// If cipherStream exited abnormally, return its error.
-	return cipherStream.Error
+		if r.progress != nil {
+			r.progress(total)
+		}
+		return nil
+	})
+	return total, err
 }
@@ -0,0 +1,133 @@
+// Package shamir splits secrets, such as blobcrypt keys, into shares using Shamir's Secret Sharing,
+// so that any threshold number of shares can recover the secret, but fewer reveal nothing about it.
+//
+// Arithmetic is performed byte-wise in GF(2^8) with the AES polynomial. Each share is the
+// evaluation of the secret's polynomials at a distinct non-zero x coordinate, which is stored
+// as the final byte of the share; Shares are therefore one byte longer than the secret.
+package shamir
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// MaxShares is the largest number of shares a secret may be split into.
+const MaxShares = 255
+
+// Split divides secret into n shares, any k of which can be combined to recover it.
+func Split(secret []byte, n, k int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("Secret must not be empty")
+	}
+	if k < 2 || k > n {
+		return nil, fmt.Errorf("Threshold must be between 2 and the number of shares")
+	}
+	if n > MaxShares {
+		return nil, fmt.Errorf("At most %d shares may be created", MaxShares)
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+
+	// Each secret byte is the constant term of a random polynomial of degree k-1.
+	coefficients := make([]byte, k)
+	for b, value := range secret {
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+		coefficients[0] = value
+
+		for _, share := range shares {
+			share[b] = evaluate(coefficients, share[len(secret)])
+		}
+	}
+	return shares, nil
+}
+
+// Combine recovers a secret from at least the threshold number of its shares.
+// Combining fewer shares than the threshold returns an unrelated value without error,
+// so callers should verify the result, for example with blobcrypt.CheckKey.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, fmt.Errorf("At least 2 shares are required")
+	}
+
+	size := len(shares[0])
+	if size < 2 {
+		return nil, fmt.Errorf("Shares are too short")
+	}
+
+	xs := make([]byte, len(shares))
+	seen := map[byte]bool{}
+	for i, share := range shares {
+		if len(share) != size {
+			return nil, fmt.Errorf("Shares must all be the same length")
+		}
+		x := share[size-1]
+		if x == 0 || seen[x] {
+			return nil, fmt.Errorf("Shares must have distinct, non-zero coordinates")
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+
+	// Lagrange interpolation at x = 0 for each byte of the secret.
+	secret := make([]byte, size-1)
+	for b := range secret {
+		var value byte
+		for i, share := range shares {
+			basis := byte(1)
+			for j := range shares {
+				if i != j {
+					// In GF(2^8), subtraction is XOR, so (0 - xj) / (xi - xj) is xj / (xi ^ xj).
+					basis = mul(basis, div(xs[j], xs[i]^xs[j]))
+				}
+			}
+			value ^= mul(share[b], basis)
+		}
+		secret[b] = value
+	}
+	return secret, nil
+}
+
+// evaluate returns the value of the polynomial with the given coefficients at x, using Horner's method.
+func evaluate(coefficients []byte, x byte) byte {
+	var result byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = mul(result, x) ^ coefficients[i]
+	}
+	return result
+}
+
+// mul returns a * b in GF(2^8) with the AES polynomial x^8 + x^4 + x^3 + x + 1.
+// Operands are secret, so it runs in constant time, without branches or table lookups.
+func mul(a, b byte) byte {
+	var product byte
+	for i := 0; i < 8; i++ {
+		// Add a to the product if the low bit of b is set; -(bit) is 0x00 or 0xff.
+		product ^= -(b & 1) & a
+		b >>= 1
+		// Multiply a by x, reducing by the polynomial if its high bit overflows.
+		a = a<<1 ^ -(a>>7)&0x1b
+	}
+	return product
+}
+
+// inv returns the multiplicative inverse of a in GF(2^8), or 0 if a is 0, in constant time.
+// Every non-zero a satisfies a^255 = 1, so a^-1 = a^254 = a^2 * a^4 * ... * a^128.
+func inv(a byte) byte {
+	result := byte(1)
+	for i := 0; i < 7; i++ {
+		a = mul(a, a)
+		result = mul(result, a)
+	}
+	return result
+}
+
+// div returns a / b in GF(2^8). b must be non-zero.
+func div(a, b byte) byte {
+	return mul(a, inv(b))
+}
@@ -0,0 +1,68 @@
+package shamir
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+// TestSplitCombine ensures every threshold-sized subset of shares recovers the secret.
+func TestSplitCombine(t *testing.T) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatalf("%v reading random bytes", err)
+	}
+
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("%v splitting secret", err)
+	}
+
+	for a := 0; a < len(shares); a++ {
+		for b := a + 1; b < len(shares); b++ {
+			for c := b + 1; c < len(shares); c++ {
+				recovered, err := Combine([][]byte{shares[a], shares[b], shares[c]})
+				if err != nil {
+					t.Fatalf("%v combining shares", err)
+				}
+				if !bytes.Equal(recovered, secret) {
+					t.Fatalf("Shares %d, %d, %d did not recover the secret", a, b, c)
+				}
+			}
+		}
+	}
+
+	recovered, err := Combine(shares[:2])
+	if err != nil {
+		t.Fatalf("%v combining shares", err)
+	}
+	if bytes.Equal(recovered, secret) {
+		t.Fatal("Fewer shares than the threshold recovered the secret")
+	}
+}
+
+// TestFieldArithmetic ensures multiplication and division in GF(2^8) are inverses.
+func TestFieldArithmetic(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			if div(mul(byte(a), byte(b)), byte(b)) != byte(a) {
+				t.Fatalf("(%d * %d) / %d != %d", a, b, b, a)
+			}
+		}
+	}
+	for a := 0; a < 256; a++ {
+		if mul(byte(a), 0) != 0 || mul(0, byte(a)) != 0 {
+			t.Fatalf("%d * 0 != 0", a)
+		}
+		if a != 0 && mul(byte(a), inv(byte(a))) != 1 {
+			t.Fatalf("%d * inv(%d) != 1", a, a)
+		}
+	}
+	if inv(0) != 0 {
+		t.Fatal("inv(0) != 0")
+	}
+	// Known product from FIPS-197: {57} * {83} = {c1}
+	if mul(0x57, 0x83) != 0xc1 {
+		t.Fatalf("{57} * {83} = %02x, expected c1", mul(0x57, 0x83))
+	}
+}
@@ -0,0 +1,104 @@
+package blobcrypt
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// TreeLeafSize is the number of source bytes hashed by each leaf of ComputeTreeKey.
+const TreeLeafSize = 1 << 20
+
+// ComputeTreeKey returns an encryption key for source, hashing its leaves on multiple cores.
+// It is intended for very large sources, where ComputeKey is limited by single-threaded SHA256.
+//
+// The key is computed over a fixed, two-level layout:
+//
+//	leaf[i] = SHA256(0x00 || source[i*TreeLeafSize : (i+1)*TreeLeafSize])
+//	key     = SHA256(0x01 || uint64be(len(cs)) || cs || uint64be(size) || leaf[0] || leaf[1] || ...)
+//
+// An empty source has no leaves. The result depends only on cs and the source content,
+// never on the number of workers, but it differs from the key returned by ComputeKey,
+// so all parties deriving keys for a source must agree on which function to use.
+// If workers is zero or less, one worker per CPU is used.
+// Returns io.ErrUnexpectedEOF if source holds fewer than size bytes.
+func ComputeTreeKey(source io.ReaderAt, size int64, cs string, workers int) (Key, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("Size %d is negative", size)
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	leafCount := int((size + TreeLeafSize - 1) / TreeLeafSize)
+	leaves := make([][sha256.Size]byte, leafCount)
+
+	indexes := make(chan int)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, TreeLeafSize)
+			for i := range indexes {
+				offset := int64(i) * TreeLeafSize
+				length := size - offset
+				if length > TreeLeafSize {
+					length = TreeLeafSize
+				}
+
+				// ReadAt may return io.EOF with a full read at the end of source; Only a short read is an error.
+				n, err := source.ReadAt(buf[:length], offset)
+				if int64(n) != length {
+					if err == nil || err == io.EOF {
+						err = io.ErrUnexpectedEOF
+					}
+					errs <- err
+					return
+				}
+
+				h := sha256.New()
+				h.Write([]byte{0x00})
+				h.Write(buf[:length])
+				h.Sum(leaves[i][:0])
+			}
+		}()
+	}
+
+	// Distribute leaves until done, or until a worker fails.
+	var err error
+distribute:
+	for i := 0; i < leafCount; i++ {
+		select {
+		case indexes <- i:
+		case err = <-errs:
+			break distribute
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	if err == nil && len(errs) > 0 {
+		err = <-errs
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var lengths [16]byte
+	binary.BigEndian.PutUint64(lengths[:8], uint64(len(cs)))
+	binary.BigEndian.PutUint64(lengths[8:], uint64(size))
+
+	root := sha256.New()
+	root.Write([]byte{0x01})
+	root.Write(lengths[:8])
+	root.Write([]byte(cs))
+	root.Write(lengths[8:])
+	for i := range leaves {
+		root.Write(leaves[i][:])
+	}
+	return Key(root.Sum(nil)), nil
+}
@@ -2,12 +2,8 @@ package blobcrypt
 
 import (
 	"context"
-	"crypto/aes"
 	"crypto/cipher"
-	"crypto/hmac"
-	"crypto/sha256"
-	"crypto/sha512"
-	"fmt"
+	"hash"
 	"io"
 )
 
@@ -19,54 +15,185 @@ const (
 type Writer struct {
 	Source io.ReadSeeker
 	Key    []byte
+
+	// Suite selects the registered cipher suite used for encryption. The zero value is DefaultSuite.
+	// The suite is not recorded in the output, so readers must be told which suite to use.
+	Suite SuiteID
+
+	// Synchronous runs encryption entirely in the caller's goroutine, with no background reads.
+	Synchronous bool
+
+	bufferSize int
+	progress   func(int64)
+	ctx        context.Context
+	armor      bool
+
+	checkpoint         func(Checkpoint)
+	checkpointInterval int64
 }
 
-// NewWriter creates a writer that encrypts source using key.
-func NewWriter(source io.ReadSeeker, key []byte) (*Writer, error) {
-	if len(key) != sha256.Size {
-		return nil, fmt.Errorf("Key size is incorrect")
+// NewWriter creates a writer that encrypts source using key, configured by opts.
+func NewWriter(source io.ReadSeeker, key []byte, opts ...Option) (*Writer, error) {
+	if err := Key(key).Validate(); err != nil {
+		return nil, err
 	}
-	return &Writer{Source: source, Key: key}, nil
+	o := newOptions(opts)
+	return &Writer{
+		Source:      source,
+		Key:         key,
+		Suite:       o.suite,
+		Synchronous: o.synchronous,
+		bufferSize:  o.bufferSize,
+		progress:    o.progress,
+		ctx:         o.ctx,
+		armor:       o.armor,
+
+		checkpoint:         o.checkpoint,
+		checkpointInterval: o.checkpointInterval,
+	}, nil
 }
 
 // Encrypt encrypts the contents of the receiver to the output stream.
-// On successful return, Writer's HMAC will be set to the HMAC of the output.
+// Returns the HMAC of the encrypted content, which is also written as the output's suffix.
 func (w *Writer) Encrypt(output io.Writer) ([]byte, error) {
-	blockCipher, err := aes.NewCipher(w.Key)
+	return w.EncryptTee(output, nil)
+}
+
+// EncryptTee behaves like Encrypt, but also writes each block of encrypted content to tee
+// as it is produced, before it is written to output. The HMAC suffix is not written to tee.
+// This allows callers to checksum or otherwise process the encrypted body in the same pass;
+// Use NewMAC to compute an HMAC over the body independently.
+func (w *Writer) EncryptTee(output, tee io.Writer) ([]byte, error) {
+	return w.encrypt(output, tee)
+}
+
+// WriteTo encrypts the contents of the receiver to output, implementing io.WriterTo. The HMAC is written as the suffix of output,
+// but is not otherwise returned; Use Encrypt when it is needed separately.
+// Returns the number of bytes written to output, including the HMAC suffix.
+func (w *Writer) WriteTo(output io.Writer) (int64, error) {
+	counter := &countingWriter{w: output}
+	_, err := w.encrypt(counter, nil)
+	return counter.n, err
+}
+
+// HMAC returns the HMAC that Encrypt would produce, which identifies the encrypted blob,
+// without writing ciphertext anywhere. The content must still be enciphered to be signed,
+// but no output is copied or buffered. Source is consumed, as with Encrypt.
+func (w *Writer) HMAC() ([]byte, error) {
+	return w.encrypt(nil, nil)
+}
+
+// encrypt enciphers Source, writing content and the HMAC suffix to output unless it is nil.
+func (w *Writer) encrypt(output, tee io.Writer) ([]byte, error) {
+	if w.armor && w.checkpoint != nil {
+		return nil, ErrCheckpointArmor
+	}
+	suite, err := LookupSuite(w.Suite)
+	if err != nil {
+		return nil, err
+	}
+
+	// DefaultSuite uses a resumable MAC, so that checkpoints can be taken during encryption.
+	if w.Suite == DefaultSuite {
+		hmacFinal, _, err := w.encryptFrom(output, tee, Checkpoint{})
+		return hmacFinal, err
+	} else if w.checkpoint != nil {
+		return nil, ErrCheckpointUnsupported
+	}
+
+	stream, err := suite.NewStream(w.Key)
 	if err != nil {
 		return nil, err
 	}
 
-	iv := shaSlice256(w.Key)
-	hmacKey := shaSlice256(iv)
+	_, hmacFinal, err := w.encryptStream(output, tee, stream, suite.NewMAC(w.Key), 0)
+	return hmacFinal, err
+}
 
-	// Configure a cancelable context, ensuring goroutines won't be leaked on early return.
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// encryptStream enciphers Source with stream, signing the result with mac.
+// The stream and mac must already be positioned at offset bytes into the content.
+// Returns the number of content bytes written, and the final HMAC.
+func (w *Writer) encryptStream(output, tee io.Writer, stream cipher.Stream, mac hash.Hash, offset int64) (int64, []byte, error) {
+	var armored *ArmorWriter
+	if w.armor && output != nil {
+		armored = NewArmorWriter(output)
+		output = armored
+	}
 
 	cipherStream := CipherStream{
-		Source: w.Source,
-		Cipher: cipher.NewCTR(blockCipher, iv[:blockCipher.BlockSize()]),
+		Source:      w.Source,
+		Cipher:      stream,
+		Synchronous: w.Synchronous,
+		BufferSize:  w.bufferSize,
 	}
 
-	// Encrypt input file in parallel with output, and calculate HMAC as we go.
-	mac := hmac.New(sha512.New, hmacKey)
-	for buf := range cipherStream.Stream(ctx) {
+	// Encrypt input file to output, and calculate HMAC as we go.
+	var total int64
+	err := cipherStream.Each(contextOrBackground(w.ctx), func(buf []byte) error {
 		// According to documentation, Hash.Write never returns an error.
 		mac.Write(buf)
 
-		if _, err := output.Write(buf); err != nil {
-			return nil, err
+		if tee != nil {
+			if _, err := tee.Write(buf); err != nil {
+				return err
+			}
 		}
-	}
 
-	// If cipherStream exited abnormally due to a read error, return it
-	if err := cipherStream.Error; err != nil {
-		return nil, err
+		if output != nil {
+			if _, err := output.Write(buf); err != nil {
+				return err
+			}
+		}
+
+		previous := total
+		total += int64(len(buf))
+		if w.progress != nil {
+			w.progress(offset + total)
+		}
+
+		// Checkpoints are taken after output is written, so output always holds checkpoint.Offset bytes;
+		// Armored output doesn't, which is why checkpoints and armor are mutually exclusive.
+		if w.checkpoint != nil && (offset+total)/w.checkpointInterval > (offset+previous)/w.checkpointInterval {
+			if resumable, ok := mac.(*resumableMAC); ok {
+				checkpoint, err := resumable.checkpoint(offset + total)
+				if err != nil {
+					return err
+				}
+				w.checkpoint(checkpoint)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
 	}
 
 	// Otherwise, write the HMAC suffix
 	hmacFinal := mac.Sum(nil)
-	_, err = output.Write(hmacFinal)
-	return hmacFinal, err
+	if output == nil {
+		return total, hmacFinal, nil
+	}
+	if _, err := output.Write(hmacFinal); err != nil {
+		return 0, nil, err
+	}
+
+	// Armored output is only complete once its footer is written.
+	if armored != nil {
+		if err := armored.Close(); err != nil {
+			return 0, nil, err
+		}
+	}
+	return total, hmacFinal, nil
+}
+
+// countingWriter counts the bytes successfully written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
 }